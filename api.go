@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/serf/serf"
+	"go.uber.org/zap"
+)
+
+// apiRoute describes an API endpoint. Request and Response are example values used to document the route.
+type apiRoute struct {
+	Method      string
+	Path        string
+	Summary     string
+	Role        apiRole
+	Query       []string
+	Request     interface{}
+	Response    interface{}
+	Status      int
+	ContentType string
+	Handler     http.HandlerFunc
+}
+
+// StatusResponse .
+type StatusResponse struct {
+	Node       string         `json:"node"`
+	Leader     string         `json:"leader"`
+	AmLeader   bool           `json:"amLeader"`
+	Generation int            `json:"generation"`
+	Paused     bool           `json:"paused"`
+	Members    []MemberStatus `json:"members"`
+}
+
+// MemberStatus .
+type MemberStatus struct {
+	Name   string `json:"name"`
+	Addr   string `json:"addr"`
+	Status string `json:"status"`
+}
+
+// IdentityResponse .
+type IdentityResponse struct {
+	Identity string `json:"identity"`
+	Role     string `json:"role"`
+}
+
+// ReconcileResponse .
+type ReconcileResponse struct {
+	Status string `json:"status"`
+}
+
+// ApproveRequest .
+type ApproveRequest struct {
+	ID     string   `json:"id"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+// PauseResponse .
+type PauseResponse struct {
+	Paused bool `json:"paused"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Error encoding API response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{`error`: err.Error()})
+}
+
+func apiRoutes(config *Config, cluster *serf.Serf, db *OneAndOnlyNumber) []apiRoute {
+	return []apiRoute{
+		{Method: "GET", Path: "/get", Role: roleRead, Handler: func(w http.ResponseWriter, r *http.Request) {
+			val, _, _ := db.getValue()
+			fmt.Fprintf(w, "%v", val)
+		}},
+		{Path: "/set/{newVal}/{metadata}", Role: roleOperator, Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			newVal, err := strconv.Atoi(vars["newVal"])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "%v", err)
+				return
+			}
+			db.setValue(newVal, vars["metadata"])
+			fmt.Fprintf(w, "%v", newVal)
+		}},
+		{Method: "POST", Path: "/notify/{curVal}/{curGeneration}", Role: rolePeer, Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			curVal, err := strconv.Atoi(vars["curVal"])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "%v", err)
+				return
+			}
+			curGeneration, err := strconv.Atoi(vars["curGeneration"])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "%v", err)
+				return
+			}
+
+			notifier := r.URL.Query().Get("notifier")
+			if changed := db.notifyValue(curVal, curGeneration, notifier); changed {
+				logger.Info("New Value Notification", zap.Int("NewValue", curVal), zap.Int("Generation", curGeneration), zap.String("Notifier", notifier))
+				w.WriteHeader(http.StatusOK)
+			}
+		}},
+		{Method: "GET", Path: "/v1/status", Summary: "Cluster membership and leader status", Role: roleRead, Response: StatusResponse{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			_, gen, leader := db.getValue()
+			status := StatusResponse{
+				Node:       cluster.LocalMember().Name,
+				Leader:     leader,
+				AmLeader:   amLeader(),
+				Generation: gen,
+				Paused:     isPaused(),
+			}
+			for _, m := range cluster.Members() {
+				status.Members = append(status.Members, MemberStatus{Name: m.Name, Addr: m.Addr.String(), Status: m.Status.String()})
+			}
+			writeJSON(w, http.StatusOK, status)
+		}},
+		{Method: "GET", Path: "/v1/whoami", Summary: "Identity and role of the calling token", Role: roleRead, Response: IdentityResponse{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, IdentityResponse{Identity: requestIdentity(r), Role: requestRole(r).String()})
+		}},
+		{Method: "GET", Path: "/v1/routes", Summary: "Last reconcile outcome of every route", Role: roleRead, Response: []RouteStatus{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, routeStatuses.list(config))
+		}},
+		{Method: "GET", Path: "/v1/settings", Summary: "Effective settings of every route", Role: roleRead, Response: []RouteSettings{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, listRouteSettings(config, time.Now()))
+		}},
+		{Method: "GET", Path: "/v1/routes/{name}/settings", Summary: "Effective settings of a route", Role: roleRead, Response: RouteSettings{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["name"]
+			C, ok := config.Clusters[name]
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", name))
+				return
+			}
+			writeJSON(w, http.StatusOK, routeSettings(name, C, time.Now()))
+		}},
+		{Method: "GET", Path: eventsPath, Summary: "Server-sent stream of skrr events", Role: roleRead, ContentType: "text/event-stream", Handler: serveEvents},
+		{Method: "GET", Path: "/metrics", Role: roleRead, Handler: serveMetrics(config)},
+		{Method: "GET", Path: "/v1/openapi.json", Summary: "This document", Role: roleNone, Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, openAPISpec(apiRoutes(config, cluster, db)))
+		}},
+		{Method: "GET", Path: "/", Role: roleNone, Handler: func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/ui", http.StatusFound)
+		}},
+		{Method: "GET", Path: "/ui", Role: roleNone, Handler: serveDashboard},
+		{Method: "POST", Path: "/v1/reconcile", Summary: "Queue a reconcile of every route on the leader", Role: roleOperator, Response: ReconcileResponse{}, Status: http.StatusAccepted, Handler: func(w http.ResponseWriter, r *http.Request) {
+			queueReconcile(w, db, reconcileRequest{Identity: requestIdentity(r)})
+		}},
+		{Method: "POST", Path: "/v1/plan", Summary: "Queue a dry run plan of every route on the leader", Role: roleOperator, Response: ReconcileResponse{}, Status: http.StatusAccepted, Handler: func(w http.ResponseWriter, r *http.Request) {
+			queueReconcile(w, db, reconcileRequest{Identity: requestIdentity(r), DryRun: true})
+		}},
+		{Method: "GET", Path: "/v1/plans", Summary: "Latest plan of every route", Role: roleRead, Response: []Plan{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			plans := []Plan{}
+			for _, status := range routeStatuses.list(config) {
+				if status.Plan != nil {
+					plans = append(plans, *status.Plan)
+				}
+			}
+			writeJSON(w, http.StatusOK, plans)
+		}},
+		{Method: "GET", Path: "/v1/routes/{name}/plan", Summary: "Latest plan of a route", Role: roleRead, Response: Plan{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["name"]
+			status, ok := routeStatuses.get(name)
+			if !ok || status.Plan == nil {
+				writeError(w, http.StatusNotFound, fmt.Errorf("no plan for route %v", name))
+				return
+			}
+			writeJSON(w, http.StatusOK, status.Plan)
+		}},
+		{Method: "GET", Path: "/v1/routes/{name}/topics/{topic}/explain", Summary: "Explain what a route knows about a topic and the decision its planner makes", Role: roleRead, Response: TopicExplanation{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			C, ok := config.Clusters[vars["name"]]
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", vars["name"]))
+				return
+			}
+			explanation, err := explainRoute(r.Context(), C, vars["name"], vars["topic"])
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, explanation)
+		}},
+		{Method: "GET", Path: "/v1/routes/{name}/blacklist", Summary: "Blacklist entries of a route and who owns them", Role: roleRead, Response: []BlacklistEntry{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["name"]
+			C, ok := config.Clusters[name]
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", name))
+				return
+			}
+			rc := newRouteClient(name)
+			err := rc.launchZKClient(C.ZKAddress)
+			if err == nil {
+				err = rc.getZKTarget(C.ZKRoot, name)
+			}
+			var entries []BlacklistEntry
+			if err == nil {
+				entries, err = rc.listBlacklist(C.ZKRoot, C.StatePath)
+			}
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, entries)
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/blacklist/{topic}/adopt", Summary: "Adopt an operator blacklist entry so the route may whitelist it", Role: roleOperator, Response: BlacklistEntry{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			ownBlacklistEntry(w, r, config, ownerSkrr)
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/blacklist/{topic}/release", Summary: "Hand a blacklist entry to the operators so the route never whitelists it", Role: roleOperator, Response: BlacklistEntry{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			ownBlacklistEntry(w, r, config, ownerOperator)
+		}},
+		{Method: "GET", Path: "/v1/leases", Summary: "Replication leases of every route, soonest to expire first", Role: roleRead, Query: []string{"route"}, Response: []Lease{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			leases, err := routeLeases(config, r.URL.Query().Get("route"))
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, leases)
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/leases", Summary: "Whitelist a topic on a route until its lease expires", Role: roleOperator, Request: LeaseRequest{}, Response: LeaseResponse{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["name"]
+			C, ok := config.Clusters[name]
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", name))
+				return
+			}
+			var req LeaseRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+			if _, err := parseTTL(req.TTL); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			resp, err := startLease(C, name, req, requestIdentity(r))
+			if err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, resp)
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/leases/{topic}/extend", Summary: "Extend the replication lease of a topic", Role: roleOperator, Request: ExtendRequest{}, Response: Lease{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			C, ok := config.Clusters[vars["name"]]
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", vars["name"]))
+				return
+			}
+			var req ExtendRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+			lease, err := extendLease(C, vars["name"], vars["topic"], req.TTL, requestIdentity(r))
+			if err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, lease)
+		}},
+		{Method: "GET", Path: "/v1/migrations", Summary: "Topic migrations between routes, newest first", Role: roleRead, Response: []Migration{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			list, err := listMigrations(config)
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, list)
+		}},
+		{Method: "POST", Path: "/v1/migrations", Summary: "Start moving the replication of a topic to another route", Role: roleOperator, Request: MigrationRequest{}, Response: Migration{}, Status: http.StatusAccepted, Handler: func(w http.ResponseWriter, r *http.Request) {
+			if !requireLeader(w, db) {
+				return
+			}
+			var req MigrationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+			m, err := startMigration(config, req, requestIdentity(r))
+			if err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, m)
+		}},
+		{Method: "GET", Path: "/v1/migrations/{id}", Summary: "Status of a topic migration and its steps", Role: roleRead, Response: Migration{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			id := mux.Vars(r)["id"]
+			m, ok, err := findMigration(config, id)
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("migration %v not found", id))
+				return
+			}
+			writeJSON(w, http.StatusOK, m)
+		}},
+		{Method: "POST", Path: "/v1/migrations/{id}/abort", Summary: "Stop a migration before it blacklists the topic on the old route", Role: roleOperator, Request: AbortRequest{}, Response: Migration{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			if !requireLeader(w, db) {
+				return
+			}
+			id := mux.Vars(r)["id"]
+			var req AbortRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+			identity := requestIdentity(r)
+			m, err := abortMigration(config, id, identity, req.Revert)
+			if err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			logger.Info("Migration Abort Requested", zap.String("Migration", id), zap.String("Identity", identity), zap.Bool("Revert", req.Revert))
+			writeJSON(w, http.StatusOK, m)
+		}},
+		{Method: "GET", Path: "/v1/pending", Summary: "Topics awaiting confirmation before they qualify for an action", Role: roleRead, Query: []string{"route"}, Response: []PendingCandidate{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, pendingCandidates.list(r.URL.Query().Get("route")))
+		}},
+		{Method: "GET", Path: "/v1/held", Summary: "Plans held for operator approval", Role: roleRead, Response: []HeldPlan{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			held, err := heldPlans.list(config, time.Now())
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, held)
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/approve", Summary: "Approve the plan held for a route, or some of its topics, and queue its reconcile on the leader", Role: roleOperator, Request: ApproveRequest{}, Response: HeldPlan{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			if !requireLeader(w, db) {
+				return
+			}
+			name := mux.Vars(r)["name"]
+			C, ok := config.Clusters[name]
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", name))
+				return
+			}
+			var req ApproveRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+			held, err := heldPlans.approve(C, name, req.ID, requestIdentity(r), req.Topics, time.Now())
+			if err != nil {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			logger.Info("Plan Approved", zap.String("Cluster", name), zap.String("Plan", held.ID), zap.String("Identity", held.ApprovedBy), zap.Strings("Topics", held.Topics))
+			requestReconcile(reconcileRequest{Identity: held.ApprovedBy, Route: name})
+			writeJSON(w, http.StatusOK, held)
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/plan", Summary: "Queue a dry run plan of a route on the leader", Role: roleOperator, Response: ReconcileResponse{}, Status: http.StatusAccepted, Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["name"]
+			if _, ok := config.Clusters[name]; !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", name))
+				return
+			}
+			queueReconcile(w, db, reconcileRequest{Identity: requestIdentity(r), Route: name, DryRun: true})
+		}},
+		{Method: "POST", Path: "/v1/routes/{name}/reconcile", Summary: "Queue a reconcile of a route on the leader", Role: roleOperator, Response: ReconcileResponse{}, Status: http.StatusAccepted, Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["name"]
+			if _, ok := config.Clusters[name]; !ok {
+				writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", name))
+				return
+			}
+			queueReconcile(w, db, reconcileRequest{Identity: requestIdentity(r), Route: name})
+		}},
+		{Method: "GET", Path: "/v1/history", Summary: "Recorded reconcile runs, newest first", Role: roleRead, Query: []string{"route", "topic", "since", "until", "limit"}, Response: []RunRecord{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			filter, err := parseHistoryFilter(r)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			records, err := runHistory.query(filter)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, records)
+		}},
+		{Method: "POST", Path: "/v1/rollback", Summary: "Undo executed actions of a run or time window, or preview the undo with dryRun", Role: roleOperator, Request: RollbackRequest{}, Response: RollbackResponse{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req RollbackRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+				return
+			}
+			steps, err := rollbackSteps(config, req)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if !req.DryRun {
+				steps = rollback(config, steps, requestIdentity(r))
+			}
+			writeJSON(w, http.StatusOK, RollbackResponse{DryRun: req.DryRun, Steps: steps})
+		}},
+		{Method: "POST", Path: "/v1/pause", Summary: "Pause scheduled reconciliation", Role: roleOperator, Response: PauseResponse{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			setPaused(true)
+			writeJSON(w, http.StatusOK, PauseResponse{Paused: true})
+		}},
+		{Method: "POST", Path: "/v1/resume", Summary: "Resume scheduled reconciliation", Role: roleOperator, Response: PauseResponse{}, Handler: func(w http.ResponseWriter, r *http.Request) {
+			setPaused(false)
+			writeJSON(w, http.StatusOK, PauseResponse{Paused: false})
+		}},
+	}
+}
+
+// ownBlacklistEntry sets the owner of the blacklist entry named in the request path.
+func ownBlacklistEntry(w http.ResponseWriter, r *http.Request, config *Config, owner string) {
+	vars := mux.Vars(r)
+	C, ok := config.Clusters[vars["name"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown route %v", vars["name"]))
+		return
+	}
+	identity := requestIdentity(r)
+	entry, err := setBlacklistOwner(C, vars["name"], vars["topic"], owner, identity)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	logger.Info("Blacklist Owner Set", zap.String("Cluster", vars["name"]), zap.String("Topic", entry.Topic), zap.String("Owner", owner), zap.String("Identity", identity))
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// parseHistoryFilter reads a historyFilter from the query: since and until are RFC 3339 times.
+func parseHistoryFilter(r *http.Request) (historyFilter, error) {
+	q := r.URL.Query()
+	filter := historyFilter{
+		Route: q.Get("route"),
+		Topic: q.Get("topic"),
+	}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid since: %v", err)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid until: %v", err)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			return filter, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	return filter, nil
+}
+
+// requireLeader writes a conflict naming the leader when this node is not it.
+func requireLeader(w http.ResponseWriter, db *OneAndOnlyNumber) bool {
+	if !amLeader() {
+		_, _, leader := db.getValue()
+		writeError(w, http.StatusConflict, fmt.Errorf("not the leader, current leader is %v", leader))
+		return false
+	}
+	return true
+}
+
+func queueReconcile(w http.ResponseWriter, db *OneAndOnlyNumber, req reconcileRequest) {
+	if !requireLeader(w, db) {
+		return
+	}
+	if !requestReconcile(req) {
+		writeError(w, http.StatusConflict, fmt.Errorf("a reconcile is already queued"))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, ReconcileResponse{Status: `queued`})
+}
+
+// apiHandler routes every API endpoint to its handler behind the authorization of its role.
+func apiHandler(config *Config, cluster *serf.Serf, db *OneAndOnlyNumber) http.Handler {
+	m := mux.NewRouter()
+	for _, route := range apiRoutes(config, cluster, db) {
+		r := m.HandleFunc(route.Path, authorize(route.Role, config.Monitor.Auth.Enabled, route.Handler))
+		if route.Method != "" {
+			r.Methods(route.Method)
+		}
+	}
+	return m
+}
+
+func launchHTTPAPI(config *Config, cluster *serf.Serf, db *OneAndOnlyNumber) {
+	go func() {
+		m := apiHandler(config, cluster, db)
+		logger.Info(`Started API`, zap.String("address", apiAddr), zap.Bool("TLS", apiTLS != nil), zap.Bool("Auth", config.Monitor.Auth.Enabled))
+		var err error
+		switch {
+		case apiTLS != nil:
+			srv := &http.Server{
+				Addr:      apiAddr,
+				Handler:   m,
+				TLSConfig: apiTLS.serverConfig(),
+			}
+			err = srv.ListenAndServeTLS("", "")
+		default:
+			err = http.ListenAndServe(apiAddr, m)
+		}
+		if err != nil {
+			logger.Fatal("API Failure", zap.Error(err))
+		}
+	}()
+}
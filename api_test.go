@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jbvmio/serfcluster/client"
+	"go.uber.org/zap"
+)
+
+// apiCapture records the body of the last API response, so a client result can be compared
+// with what the server sent.
+type apiCapture struct {
+	mu   sync.Mutex
+	body []byte
+}
+
+func (c *apiCapture) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		c.mu.Lock()
+		c.body = rec.Body.Bytes()
+		c.mu.Unlock()
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	})
+}
+
+// matches fails the test unless got, a client result, encodes to the JSON the server sent, so
+// a field the client leaves out, renames or types differently is caught.
+func (c *apiCapture) matches(t *testing.T, method string, got interface{}, err error) {
+	t.Helper()
+	if err != nil {
+		t.Errorf("%v: %v", method, err)
+		return
+	}
+	c.mu.Lock()
+	body := c.body
+	c.mu.Unlock()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("%v: encode client result: %v", method, err)
+	}
+	var want, have interface{}
+	if err := json.Unmarshal(body, &want); err != nil {
+		t.Fatalf("%v: decode server response %s: %v", method, body, err)
+	}
+	if err := json.Unmarshal(data, &have); err != nil {
+		t.Fatalf("%v: decode client result %s: %v", method, data, err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("%v: client decoded\n%s\nserver sent\n%s", method, data, body)
+	}
+}
+
+// wantAPIError fails the test unless err is the error a handler wrote, not one of the router.
+func wantAPIError(t *testing.T, method string, err error, status int, message string) {
+	t.Helper()
+	apiErr, ok := err.(*client.Error)
+	if !ok {
+		t.Errorf("%v: error = %v; want an API error", method, err)
+		return
+	}
+	if apiErr.StatusCode != status || apiErr.Message != message {
+		t.Errorf("%v: error = %v %q; want %v %q", method, apiErr.StatusCode, apiErr.Message, status, message)
+	}
+}
+
+// fill sets every exported field reachable from v to a value that is not zero, so no field is
+// left out of its JSON by omitempty.
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				fill(v.Field(i))
+			}
+		}
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		key, elem := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		fill(key)
+		fill(elem)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, elem)
+	case reflect.String:
+		v.SetString(`x`)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	}
+}
+
+// withAPI serves the API handlers of config and returns a client of them. The route statuses,
+// pending candidates and history are replaced for the test.
+func withAPI(t *testing.T, config *Config) (*client.Client, *apiCapture) {
+	t.Helper()
+	logger = zap.NewNop()
+	dir, err := ioutil.TempDir("", "skrr-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := openHistory(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStatuses, savedPending, savedHistory, savedLevel := routeStatuses, pendingCandidates, runHistory, logFilter.MinLevel
+	logFilter.MinLevel = `ERROR`
+	routeStatuses = &routeStatusStore{routes: make(map[string]RouteStatus)}
+	pendingCandidates = &pendingTracker{routes: make(map[string]map[string]*PendingCandidate)}
+	runHistory = history
+	cluster, err := setupCluster(`127.0.0.1`, `127.0.0.1`, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture := &apiCapture{}
+	srv := httptest.NewServer(capture.wrap(apiHandler(config, cluster, InitTheNumber(0))))
+	t.Cleanup(func() {
+		srv.Close()
+		cluster.Shutdown()
+		routeStatuses, pendingCandidates, runHistory, logFilter.MinLevel = savedStatuses, savedPending, savedHistory, savedLevel
+		setLeader(false)
+		setPaused(false)
+		os.RemoveAll(dir)
+	})
+	setLeader(false)
+	return client.New(srv.URL), capture
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	windows := mustWindows(t, time.UTC, `sat 09:00-10:00`)
+	config := &Config{Clusters: map[string]Cluster{
+		`atl-atl`: {
+			Execute:   true,
+			Mode:      whitelistAction,
+			Reconcile: time.Minute,
+			Timeout:   time.Second,
+			Windows:   []string{`sat 09:00-10:00`},
+			Timezone:  `UTC`,
+			Approval:  true,
+			windows:   windows,
+			overrides: []string{`execute`},
+		},
+	}}
+	c, capture := withAPI(t, config)
+	ctx := context.Background()
+
+	var status RouteStatus
+	fill(reflect.ValueOf(&status).Elem())
+	status.Name = `atl-atl`
+	routeStatuses.set(status)
+	var candidate PendingCandidate
+	fill(reflect.ValueOf(&candidate).Elem())
+	candidate.Route = `atl-atl`
+	pendingCandidates.routes[`atl-atl`] = map[string]*PendingCandidate{candidate.Topic: &candidate}
+	var run RunRecord
+	fill(reflect.ValueOf(&run).Elem())
+	run.Route = `atl-atl`
+	run.Results[0].Error = ""
+	runHistory.record(run)
+
+	clusterStatus, err := c.Status(ctx)
+	capture.matches(t, `Status`, clusterStatus, err)
+	routes, err := c.Routes(ctx)
+	capture.matches(t, `Routes`, routes, err)
+	plans, err := c.Plans(ctx)
+	capture.matches(t, `Plans`, plans, err)
+	plan, err := c.Plan(ctx, `atl-atl`)
+	capture.matches(t, `Plan`, plan, err)
+	pending, err := c.Pending(ctx, `atl-atl`)
+	capture.matches(t, `Pending`, pending, err)
+	settings, err := c.Settings(ctx)
+	capture.matches(t, `Settings`, settings, err)
+	routeSettings, err := c.RouteSettings(ctx, `atl-atl`)
+	capture.matches(t, `RouteSettings`, routeSettings, err)
+	records, err := c.History(ctx, client.HistoryQuery{Route: `atl-atl`, Since: run.Start.Add(-time.Hour), Limit: 1})
+	capture.matches(t, `History`, records, err)
+	rollback, err := c.Rollback(ctx, client.RollbackRequest{Run: run.ID, DryRun: true})
+	capture.matches(t, `Rollback`, rollback, err)
+	if rollback != nil && len(rollback.Steps) != 1 {
+		t.Errorf("Rollback: %v steps; want 1", len(rollback.Steps))
+	}
+	leases, err := c.Leases(ctx, `other`)
+	capture.matches(t, `Leases`, leases, err)
+
+	if err := c.Pause(ctx); err != nil || !isPaused() {
+		t.Errorf("Pause: %v, paused %v", err, isPaused())
+	}
+	if err := c.Resume(ctx); err != nil || isPaused() {
+		t.Errorf("Resume: %v, paused %v", err, isPaused())
+	}
+	if err := c.Notify(ctx, 1, 1, `peer`); err != nil {
+		t.Errorf("Notify: %v", err)
+	}
+
+	notLeader := `not the leader, current leader is peer`
+	wantAPIError(t, `Reconcile`, c.Reconcile(ctx), http.StatusConflict, notLeader)
+	wantAPIError(t, `ReconcileRoute`, c.ReconcileRoute(ctx, `atl-atl`), http.StatusConflict, notLeader)
+	wantAPIError(t, `RequestPlan`, c.RequestPlan(ctx, ""), http.StatusConflict, notLeader)
+	wantAPIError(t, `RequestPlan`, c.RequestPlan(ctx, `atl-atl`), http.StatusConflict, notLeader)
+	_, err = c.Approve(ctx, `atl-atl`, `plan`, `orders`)
+	wantAPIError(t, `Approve`, err, http.StatusConflict, notLeader)
+	_, err = c.StartMigration(ctx, client.MigrationRequest{Topic: `orders`, From: `atl-atl`, To: `atl-dal`})
+	wantAPIError(t, `StartMigration`, err, http.StatusConflict, notLeader)
+	_, err = c.AbortMigration(ctx, `migration`, true)
+	wantAPIError(t, `AbortMigration`, err, http.StatusConflict, notLeader)
+
+	unknown := `unknown route nope`
+	_, err = c.Explain(ctx, `nope`, `orders`)
+	wantAPIError(t, `Explain`, err, http.StatusNotFound, unknown)
+	_, err = c.Blacklist(ctx, `nope`)
+	wantAPIError(t, `Blacklist`, err, http.StatusNotFound, unknown)
+	_, err = c.Adopt(ctx, `nope`, `orders`)
+	wantAPIError(t, `Adopt`, err, http.StatusNotFound, unknown)
+	_, err = c.Release(ctx, `nope`, `orders`)
+	wantAPIError(t, `Release`, err, http.StatusNotFound, unknown)
+	_, err = c.StartLease(ctx, `nope`, client.LeaseRequest{Topic: `orders`, TTL: `1h`})
+	wantAPIError(t, `StartLease`, err, http.StatusNotFound, unknown)
+	_, err = c.ExtendLease(ctx, `nope`, `orders`, `1h`)
+	wantAPIError(t, `ExtendLease`, err, http.StatusNotFound, unknown)
+}
+
+// TestClientRoundTripStored runs the client methods reading state stored per route in
+// ZooKeeper against a node without routes.
+func TestClientRoundTripStored(t *testing.T) {
+	c, capture := withAPI(t, &Config{})
+	ctx := context.Background()
+	migrations, err := c.Migrations(ctx)
+	capture.matches(t, `Migrations`, migrations, err)
+	held, err := c.Held(ctx)
+	capture.matches(t, `Held`, held, err)
+	leases, err := c.Leases(ctx, "")
+	capture.matches(t, `Leases`, leases, err)
+	_, err = c.Migration(ctx, `nope`)
+	wantAPIError(t, `Migration`, err, http.StatusNotFound, `migration nope not found`)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gozk "github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	reasonApproval = `route requires approval`
+
+	// heldPath holds the plan a route holds for approval, under its state path.
+	heldPath = `/held`
+)
+
+// HeldPlan is a Plan that was not executed and waits for operator approval. Only the Topics
+// approved are executed, every topic of the plan when none are given. Expires is zero when the
+// plan may be approved at any time. Held plans are saved under the state path of their route.
+type HeldPlan struct {
+	ID         string    `json:"id"`
+	Route      string    `json:"route"`
+	Reason     string    `json:"reason"`
+	Held       time.Time `json:"held"`
+	Expires    time.Time `json:"expires"`
+	Approved   bool      `json:"approved"`
+	ApprovedBy string    `json:"approvedBy,omitempty"`
+	Topics     []string  `json:"topics,omitempty"`
+	Diff       []string  `json:"diff"`
+	Plan       Plan      `json:"plan"`
+}
+
+func (h *HeldPlan) expired(now time.Time) bool {
+	return !h.Expires.IsZero() && now.After(h.Expires)
+}
+
+// revalidate matches the approved actions of a held plan against a freshly computed plan of the
+// same route. Actions still planned unchanged are returned as approved, the others as stale.
+func (h *HeldPlan) revalidate(fresh Plan) (approved, stale []PlanAction) {
+	current := make(map[string]PlanAction, len(fresh.Actions))
+	for _, a := range fresh.Actions {
+		current[a.key()] = a
+	}
+	topics := newTopicSet(h.Topics...)
+	for _, a := range h.Plan.Actions {
+		if len(h.Topics) > 0 && !topics.has(a.Topic) {
+			continue
+		}
+		if c, ok := current[a.key()]; ok {
+			approved = append(approved, c)
+			continue
+		}
+		stale = append(stale, a)
+	}
+	return approved, stale
+}
+
+// heldPlanStore keeps the plan held for each route under the route's state path, so held and
+// approved plans survive a restart or a failover. mu serializes the changes this node makes.
+type heldPlanStore struct {
+	mu sync.Mutex
+}
+
+var heldPlans = &heldPlanStore{}
+
+// holdPlan returns prev updated with plan when it holds the same plan and has not expired,
+// otherwise plan newly held until ttl passes, forever when ttl is 0.
+func holdPlan(prev *HeldPlan, plan Plan, reason string, ttl time.Duration, now time.Time) *HeldPlan {
+	if prev != nil && prev.ID == plan.ID && !prev.expired(now) {
+		prev.Plan = plan
+		prev.Reason = reason
+		prev.Diff = planDiff(plan)
+		return prev
+	}
+	h := &HeldPlan{
+		ID:     plan.ID,
+		Route:  plan.Route,
+		Reason: reason,
+		Held:   now,
+		Diff:   planDiff(plan),
+		Plan:   plan,
+	}
+	if ttl > 0 {
+		h.Expires = now.Add(ttl)
+	}
+	return h
+}
+
+// approve approves the held plan with the given ID, limited to the given topics when any are given.
+func (h *HeldPlan) approve(id, identity string, topics []string, now time.Time) error {
+	switch {
+	case h.ID != id:
+		return fmt.Errorf("plan %v is not the plan held for route %v, current plan is %v", id, h.Route, h.ID)
+	case h.expired(now):
+		return fmt.Errorf("plan %v expired at %v", id, h.Expires.Format(time.RFC3339))
+	}
+	planned := make(topicSet, len(h.Plan.Actions))
+	for _, a := range h.Plan.Actions {
+		planned[a.Topic] = struct{}{}
+	}
+	for _, t := range topics {
+		if !planned.has(t) {
+			return fmt.Errorf("topic %v is not part of plan %v", t, id)
+		}
+	}
+	h.Approved = true
+	h.ApprovedBy = identity
+	h.Topics = append([]string{}, topics...)
+	return nil
+}
+
+func heldClient(C Cluster, route string) (*routeClient, error) {
+	rc := newRouteClient(route)
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// load returns the plan held for a route, nil when there is none.
+func (s *heldPlanStore) load(C Cluster, route string) (*HeldPlan, error) {
+	rc, err := heldClient(C, route)
+	if err != nil {
+		return nil, err
+	}
+	path := C.StatePath + heldPath
+	data, err := rc.zk.Get(path)
+	switch {
+	case err == gozk.ErrNoNode:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to read %v: %v", path, err)
+	}
+	var h HeldPlan
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("unable to parse held plan %v: %v", path, err)
+	}
+	return &h, nil
+}
+
+func (s *heldPlanStore) save(C Cluster, h *HeldPlan) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	rc, err := heldClient(C, h.Route)
+	if err != nil {
+		return err
+	}
+	path := C.StatePath + heldPath
+	_, err = rc.zk.Create(path, data, "", true)
+	if err == gozk.ErrNodeExists {
+		_, err = rc.zk.Set(path, data)
+	}
+	return err
+}
+
+// hold saves a plan for approval until ttl passes, forever when ttl is 0. Holding a plan with
+// the ID already held keeps its approval state and expiry.
+func (s *heldPlanStore) hold(C Cluster, plan Plan, reason string, ttl time.Duration, now time.Time) (*HeldPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, err := s.load(C, plan.Route)
+	if err != nil {
+		return nil, err
+	}
+	h := holdPlan(prev, plan, reason, ttl, now)
+	return h, s.save(C, h)
+}
+
+// approval returns the plan held for a route if it was approved and has not expired.
+func (s *heldPlanStore) approval(C Cluster, route string, now time.Time) (HeldPlan, bool, error) {
+	h, err := s.load(C, route)
+	if err != nil || h == nil || !h.Approved || h.expired(now) {
+		return HeldPlan{}, false, err
+	}
+	return *h, true, nil
+}
+
+// approve approves the plan with the given ID held for a route, limited to the given topics when any are given.
+func (s *heldPlanStore) approve(C Cluster, route, id, identity string, topics []string, now time.Time) (*HeldPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.load(C, route)
+	switch {
+	case err != nil:
+		return nil, err
+	case h == nil:
+		return nil, fmt.Errorf("no plan held for route %v", route)
+	}
+	if err := h.approve(id, identity, topics, now); err != nil {
+		return nil, err
+	}
+	return h, s.save(C, h)
+}
+
+func (s *heldPlanStore) release(C Cluster, route string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rc, err := heldClient(C, route)
+	if err != nil {
+		return err
+	}
+	err = rc.zk.Delete(C.StatePath + heldPath)
+	if err == gozk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// list returns the held plans of every route that have not expired.
+func (s *heldPlanStore) list(config *Config, now time.Time) ([]HeldPlan, error) {
+	held := []HeldPlan{}
+	for name, C := range config.Clusters {
+		h, err := s.load(C, name)
+		if err != nil {
+			return nil, fmt.Errorf("route %v: %v", name, err)
+		}
+		if h == nil || h.expired(now) {
+			continue
+		}
+		held = append(held, *h)
+	}
+	sort.SliceStable(held, func(i, j int) bool { return held[i].Route < held[j].Route })
+	return held, nil
+}
+
+// planDiff describes the changes of a plan one per line: "-" for topics removed from
+// replication, "+" for topics added and "~" for topics changed in place.
+func planDiff(p Plan) []string {
+	replicated := make(map[string]int, len(p.Drift))
+	for _, d := range p.Drift {
+		replicated[d.Topic] = d.Replicated
+	}
+	destination := make(map[string]string, len(p.Configs))
+	for _, c := range p.Configs {
+		destination[c.Topic+` `+c.Config] = c.Destination
+	}
+	diff := make([]string, 0, len(p.Actions))
+	for _, a := range p.Actions {
+		switch a.Action {
+		case blacklistAction:
+			diff = append(diff, fmt.Sprintf("- %v %v partitions=%d", a.Action, a.Topic, a.Partitions))
+		case whitelistAction, onboardAction:
+			line := fmt.Sprintf("+ %v %v partitions=%d", a.Action, a.Topic, a.Partitions)
+			if a.Create {
+				line += ` create`
+			}
+			diff = append(diff, line)
+		case expandAction:
+			diff = append(diff, fmt.Sprintf("~ %v %v partitions=%d->%d", a.Action, a.Topic, replicated[a.Topic], a.Partitions))
+		case configAction:
+			names := make([]string, 0, len(a.Configs))
+			for k := range a.Configs {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			changes := make([]string, 0, len(names))
+			for _, k := range names {
+				changes = append(changes, fmt.Sprintf("%v=%v->%v", k, destination[a.Topic+` `+k], a.Configs[k]))
+			}
+			diff = append(diff, fmt.Sprintf("~ %v %v %v", a.Action, a.Topic, strings.Join(changes, ` `)))
+		}
+	}
+	return diff
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoldPlan(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	plan := Plan{ID: `a1`, Route: `atl-atl`, Actions: []PlanAction{{Action: blacklistAction, Topic: `gone`}}}
+	h := holdPlan(nil, plan, reasonApproval, time.Hour, now)
+	if err := h.approve(`a1`, `ops`, nil, now.Add(time.Minute)); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+
+	again := holdPlan(h, plan, reasonApproval, time.Hour, now.Add(time.Minute*5))
+	if !again.Approved || again.ApprovedBy != `ops` || !again.Held.Equal(now) || !again.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("holding the same plan again = %+v; want the approved plan held at %v", again, now)
+	}
+
+	changed := plan
+	changed.ID = `b2`
+	if next := holdPlan(again, changed, reasonApproval, time.Hour, now.Add(time.Minute*10)); next.Approved || next.ID != `b2` {
+		t.Errorf("holding a changed plan = %+v; want a new unapproved plan", next)
+	}
+	if next := holdPlan(again, plan, reasonApproval, time.Hour, now.Add(time.Hour*2)); next.Approved {
+		t.Errorf("holding the plan after it expired kept its approval")
+	}
+}
+
+func TestHeldPlanApprove(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	plan := Plan{ID: `a1`, Route: `atl-atl`, Actions: []PlanAction{{Action: blacklistAction, Topic: `gone`}, {Action: whitelistAction, Topic: `back`}}}
+	tests := []struct {
+		name   string
+		id     string
+		topics []string
+		at     time.Time
+		ok     bool
+	}{
+		{`whole plan`, `a1`, nil, now, true},
+		{`some topics`, `a1`, []string{`back`}, now, true},
+		{`other plan`, `b2`, nil, now, false},
+		{`topic not planned`, `a1`, []string{`keep`}, now, false},
+		{`expired`, `a1`, nil, now.Add(time.Hour * 2), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := holdPlan(nil, plan, reasonApproval, time.Hour, now)
+			err := h.approve(tt.id, `ops`, tt.topics, tt.at)
+			if (err == nil) != tt.ok {
+				t.Fatalf("approve = %v; want ok %v", err, tt.ok)
+			}
+			if h.Approved != tt.ok {
+				t.Errorf("approved = %v; want %v", h.Approved, tt.ok)
+			}
+		})
+	}
+}
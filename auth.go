@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	tokenEnvPrefix              = `SKRR_TOKEN_`
+	identityKey    notifierType = `identity`
+	roleKey        notifierType = `role`
+)
+
+type apiRole uint8
+
+const (
+	roleNone     apiRole = 0
+	roleRead     apiRole = 1
+	roleOperator apiRole = 2
+	rolePeer     apiRole = 3
+)
+
+func (r apiRole) String() string {
+	switch r {
+	case roleRead:
+		return `read`
+	case roleOperator:
+		return `operator`
+	case rolePeer:
+		return `peer`
+	default:
+		return `none`
+	}
+}
+
+func parseRole(role string) (apiRole, error) {
+	switch strings.ToLower(role) {
+	case `read`, `readonly`, `read-only`:
+		return roleRead, nil
+	case `operator`:
+		return roleOperator, nil
+	}
+	return roleNone, fmt.Errorf("invalid role %q", role)
+}
+
+type apiToken struct {
+	Name   string
+	Role   apiRole
+	secret string
+}
+
+var apiTokens []apiToken
+
+// peerToken is sent with leader notifications to other nodes.
+var peerToken string
+
+// loadTokens reads tokens from the token file, one "<name> <role> <token>" entry per line,
+// and from SKRR_TOKEN_<NAME>=<role>:<token> environment variables.
+func loadTokens(tokenFile string) ([]apiToken, error) {
+	var tokens []apiToken
+	if tokenFile != "" {
+		f, err := os.Open(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open token file: %v", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		var line int
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, `#`) {
+				continue
+			}
+			fields := strings.Fields(text)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("invalid token entry on line %v of %v", line, tokenFile)
+			}
+			role, err := parseRole(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %v of %v: %v", line, tokenFile, err)
+			}
+			tokens = append(tokens, apiToken{Name: fields[0], Role: role, secret: fields[2]})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read token file: %v", err)
+		}
+	}
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, tokenEnvPrefix) {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(env, tokenEnvPrefix), `=`, 2)
+		parts := strings.SplitN(kv[1], `:`, 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid token variable %v%v, expected <role>:<token>", tokenEnvPrefix, kv[0])
+		}
+		role, err := parseRole(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v%v: %v", tokenEnvPrefix, kv[0], err)
+		}
+		tokens = append(tokens, apiToken{Name: strings.ToLower(kv[0]), Role: role, secret: parts[1]})
+	}
+	return tokens, nil
+}
+
+func lookupToken(secret string) (apiToken, bool) {
+	for _, t := range apiTokens {
+		if subtle.ConstantTimeCompare([]byte(t.secret), []byte(secret)) == 1 {
+			return t, true
+		}
+	}
+	return apiToken{}, false
+}
+
+// requirePeerToken only allows requests with the peer or an operator token when TLS is
+// disabled, as no client certificate identifies the peer.
+func requirePeerToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiTLS != nil {
+			next(w, r)
+			return
+		}
+		token, ok := lookupToken(strings.TrimPrefix(r.Header.Get(`Authorization`), `Bearer `))
+		if !ok || (token.Role != rolePeer && token.Role != roleOperator) {
+			logger.Warn("Rejected peer request without a peer token", zap.String("Remote", r.RemoteAddr), zap.String("Path", r.URL.Path))
+			w.Header().Set(`WWW-Authenticate`, `Bearer`)
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "%v", "peer token required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func requestIdentity(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey).(string); ok {
+		return id
+	}
+	return `anonymous`
+}
+
+func requestRole(r *http.Request) apiRole {
+	if role, ok := r.Context().Value(roleKey).(apiRole); ok {
+		return role
+	}
+	return roleNone
+}
+
+// authorize wraps a handler with token authentication for the given role.
+// Peer routes are authenticated by client certificate, or by the peer or an operator token when
+// TLS is disabled, and public routes are not authenticated. The peer token is only accepted on
+// peer routes. Tokens are read from the Authorization header, and from the token query parameter
+// on the event stream only, so they stay out of the URLs of other requests. Mutating requests
+// are logged with the identity that made them.
+func authorize(role apiRole, authEnabled bool, next http.HandlerFunc) http.HandlerFunc {
+	switch role {
+	case roleNone:
+		return next
+	case rolePeer:
+		if authEnabled {
+			return requirePeerCert(requirePeerToken(next))
+		}
+		return requirePeerCert(next)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := `anonymous`
+		granted := roleOperator
+		if authEnabled {
+			secret := strings.TrimPrefix(r.Header.Get(`Authorization`), `Bearer `)
+			if secret == "" && r.URL.Path == eventsPath {
+				// EventSource clients cannot set headers.
+				secret = r.URL.Query().Get(`token`)
+			}
+			token, ok := lookupToken(secret)
+			switch {
+			case !ok || token.Role == rolePeer:
+				logger.Warn("Rejected API request with an invalid token", zap.String("Remote", r.RemoteAddr), zap.String("Path", r.URL.Path))
+				w.Header().Set(`WWW-Authenticate`, `Bearer`)
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprintf(w, "%v", "invalid or missing token")
+				return
+			case token.Role < role:
+				logger.Warn("Rejected API request, insufficient role", zap.String("Identity", token.Name), zap.String("Role", token.Role.String()), zap.String("Required", role.String()), zap.String("Path", r.URL.Path))
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, "%v", "insufficient role")
+				return
+			}
+			identity = token.Name
+			granted = token.Role
+		}
+		if role >= roleOperator {
+			logger.Info("API Request", zap.String("Identity", identity), zap.String("Method", r.Method), zap.String("Path", r.URL.Path), zap.String("Remote", r.RemoteAddr))
+		}
+		ctx := context.WithValue(r.Context(), identityKey, identity)
+		next(w, r.WithContext(context.WithValue(ctx, roleKey, granted)))
+	}
+}
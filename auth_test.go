@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func withTokens(t *testing.T, tokens ...apiToken) {
+	t.Helper()
+	logger = zap.NewNop()
+	saved, savedTLS := apiTokens, apiTLS
+	apiTokens, apiTLS = tokens, nil
+	t.Cleanup(func() { apiTokens, apiTLS = saved, savedTLS })
+}
+
+func authorizedStatus(role apiRole, authEnabled bool, header string) int {
+	h := authorize(role, authEnabled, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r := httptest.NewRequest(http.MethodPost, `/notify/1/1`, nil)
+	if header != "" {
+		r.Header.Set(`Authorization`, `Bearer `+header)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w.Code
+}
+
+func TestAuthorizePeerWithoutTLS(t *testing.T) {
+	withTokens(t,
+		apiToken{Name: `peer`, Role: rolePeer, secret: `peer-secret`},
+		apiToken{Name: `ops`, Role: roleOperator, secret: `ops-secret`},
+		apiToken{Name: `viewer`, Role: roleRead, secret: `read-secret`},
+	)
+	tests := []struct {
+		name   string
+		role   apiRole
+		token  string
+		status int
+	}{
+		{`peer route without token`, rolePeer, ``, http.StatusUnauthorized},
+		{`peer route with read token`, rolePeer, `read-secret`, http.StatusUnauthorized},
+		{`peer route with peer token`, rolePeer, `peer-secret`, http.StatusOK},
+		{`peer route with operator token`, rolePeer, `ops-secret`, http.StatusOK},
+		{`operator route with peer token`, roleOperator, `peer-secret`, http.StatusUnauthorized},
+		{`read route with peer token`, roleRead, `peer-secret`, http.StatusUnauthorized},
+		{`operator route with read token`, roleOperator, `read-secret`, http.StatusForbidden},
+		{`operator route with operator token`, roleOperator, `ops-secret`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authorizedStatus(tt.role, true, tt.token); got != tt.status {
+				t.Errorf("status = %v; want %v", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDisabled(t *testing.T) {
+	withTokens(t)
+	for _, role := range []apiRole{roleRead, roleOperator, rolePeer} {
+		if got := authorizedStatus(role, false, ``); got != http.StatusOK {
+			t.Errorf("%v route status = %v; want %v", role, got, http.StatusOK)
+		}
+	}
+}
+
+func TestAuthorizeQueryToken(t *testing.T) {
+	withTokens(t, apiToken{Name: `ops`, Role: roleOperator, secret: `ops-secret`})
+	tests := []struct {
+		name   string
+		role   apiRole
+		target string
+		status int
+	}{
+		{`event stream`, roleRead, eventsPath + `?token=ops-secret`, http.StatusOK},
+		{`read route`, roleRead, `/v1/status?token=ops-secret`, http.StatusUnauthorized},
+		{`operator route`, roleOperator, `/v1/routes/atl-atl/approve?token=ops-secret`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := authorize(tt.role, true, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.status {
+				t.Errorf("status = %v; want %v", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jbvmio/serfcluster/client"
+)
+
+const (
+	apiTokenEnv = `SKRR_API_TOKEN`
+	cliTimeout  = time.Second * 30
+)
+
+// runPlanCommand plans every route, or only the given one, and prints the results as JSON.
+// Nothing is executed. Topic patterns limit the plan to matching topics.
+func runPlanCommand(config *Config, route string, patterns ...string) error {
+	var names []string
+	for name := range config.Clusters {
+		if route == "" || route == name {
+			names = append(names, name)
+		}
+	}
+	if len(names) < 1 {
+		return fmt.Errorf("unknown route %v", route)
+	}
+	sort.Strings(names)
+	results := make([]RouteStatus, 0, len(names))
+	for _, name := range names {
+		reconcileRoute(config.Clusters[name], name, config.Clusters[name].Mode, false, true, patterns...)
+		status, _ := routeStatuses.get(name)
+		results = append(results, status)
+	}
+	return printJSON(results)
+}
+
+// leaderClient returns an API client for the current leader, found through the node running on
+// this host. The token is read from SKRR_API_TOKEN.
+func leaderClient(ctx context.Context, config *Config) (*client.Client, error) {
+	if config.Monitor.TLS.Enabled {
+		reloader, err := newTLSReloader(config.Monitor.TLS)
+		if err != nil {
+			return nil, err
+		}
+		apiTLS = reloader
+	}
+	newClient := func(addr string) *client.Client {
+		return client.New(fmt.Sprintf("%v://%v:%v", apiScheme(), addr, config.Monitor.APIPort), client.WithHTTPClient(peerClient()), client.WithToken(os.Getenv(apiTokenEnv)))
+	}
+	addr := config.Monitor.BindAddress
+	if addr == "" || addr == `0.0.0.0` {
+		addr = `127.0.0.1`
+	}
+	local := newClient(addr)
+	status, err := local.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.AmLeader {
+		return local, nil
+	}
+	for _, m := range status.Members {
+		if m.Name == status.Leader {
+			return newClient(m.Addr), nil
+		}
+	}
+	return nil, fmt.Errorf("leader %v is not a known member", status.Leader)
+}
+
+// runHeldCommand prints the plans the leader holds for approval as JSON.
+func runHeldCommand(config *Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	c, err := leaderClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	held, err := c.Held(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(held)
+}
+
+// runApproveCommand approves the plan with the given ID held for a route, only the given topics
+// of it when any are given, and prints the approved plan as JSON.
+func runApproveCommand(config *Config, route, id string, topics ...string) error {
+	if route == "" {
+		return fmt.Errorf("--route is required to approve a plan")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	c, err := leaderClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	held, err := c.Approve(ctx, route, id, topics...)
+	if err != nil {
+		return err
+	}
+	return printJSON(held)
+}
+
+// runLeaseCommand starts a lease of topic, extends the lease of extend, or lists the leases of
+// route, and prints the result as JSON.
+func runLeaseCommand(config *Config, route, topic, extend, ttl string) error {
+	if (topic != "" || extend != "") && (route == "" || ttl == "") {
+		return fmt.Errorf("--route and --ttl are required to lease a topic or extend its lease")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	c, err := leaderClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	var out interface{}
+	switch {
+	case topic != "":
+		out, err = c.StartLease(ctx, route, client.LeaseRequest{Topic: topic, TTL: ttl})
+	case extend != "":
+		out, err = c.ExtendLease(ctx, route, extend, ttl)
+	default:
+		out, err = c.Leases(ctx, route)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(out)
+}
+
+// runMigrateCommand starts a migration of topic between routes, aborts the migration with the
+// given ID, or lists the migrations, and prints the result as JSON.
+func runMigrateCommand(config *Config, topic, from, to, abort string, revert bool) error {
+	if topic != "" && (from == "" || to == "") {
+		return fmt.Errorf("--from and --to are required to migrate a topic")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+	c, err := leaderClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	var out interface{}
+	switch {
+	case topic != "":
+		out, err = c.StartMigration(ctx, client.MigrationRequest{Topic: topic, From: from, To: to})
+	case abort != "":
+		out, err = c.AbortMigration(ctx, abort, revert)
+	default:
+		out, err = c.Migrations(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(out)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
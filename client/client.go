@@ -0,0 +1,406 @@
+// Package client is a Go client for the skrr API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the skrr API of a single node.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken sets the bearer token sent with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sets the underlying http.Client, e.g. one configured for mutual TLS.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a Client for the skrr node at baseURL, e.g. https://host:31001.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, `/`),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is returned when the API responds with a non 2xx status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("skrr api: %v: %v", e.StatusCode, e.Message)
+}
+
+// Status returns the cluster membership and leader status of the node.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, `/v1/status`, nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Routes returns the last reconcile outcome of every route.
+func (c *Client) Routes(ctx context.Context) ([]RouteStatus, error) {
+	var routes []RouteStatus
+	if err := c.do(ctx, http.MethodGet, `/v1/routes`, nil, nil, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// Reconcile queues a reconcile of every route. The node must be the leader.
+func (c *Client) Reconcile(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, `/v1/reconcile`, nil, nil, nil)
+}
+
+// ReconcileRoute queues a reconcile of a single route. The node must be the leader.
+func (c *Client) ReconcileRoute(ctx context.Context, route string) error {
+	return c.do(ctx, http.MethodPost, `/v1/routes/`+url.PathEscape(route)+`/reconcile`, nil, nil, nil)
+}
+
+// Plans returns the latest plan of every route.
+func (c *Client) Plans(ctx context.Context) ([]Plan, error) {
+	var plans []Plan
+	if err := c.do(ctx, http.MethodGet, `/v1/plans`, nil, nil, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// Plan returns the latest plan of a route.
+func (c *Client) Plan(ctx context.Context, route string) (*Plan, error) {
+	var plan Plan
+	if err := c.do(ctx, http.MethodGet, `/v1/routes/`+url.PathEscape(route)+`/plan`, nil, nil, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// RequestPlan queues a dry run plan of a route, or of every route when route is empty.
+// The node must be the leader.
+func (c *Client) RequestPlan(ctx context.Context, route string) error {
+	if route == "" {
+		return c.do(ctx, http.MethodPost, `/v1/plan`, nil, nil, nil)
+	}
+	return c.do(ctx, http.MethodPost, `/v1/routes/`+url.PathEscape(route)+`/plan`, nil, nil, nil)
+}
+
+// Explain returns what a route knows about a topic and the decision its planner makes for it.
+func (c *Client) Explain(ctx context.Context, route, topic string) (*TopicExplanation, error) {
+	var explanation TopicExplanation
+	path := `/v1/routes/` + url.PathEscape(route) + `/topics/` + url.PathEscape(topic) + `/explain`
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &explanation); err != nil {
+		return nil, err
+	}
+	return &explanation, nil
+}
+
+// Blacklist returns the blacklist entries of a route and who owns them.
+func (c *Client) Blacklist(ctx context.Context, route string) ([]BlacklistEntry, error) {
+	var entries []BlacklistEntry
+	if err := c.do(ctx, http.MethodGet, `/v1/routes/`+url.PathEscape(route)+`/blacklist`, nil, nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Adopt makes skrr the owner of an operator blacklist entry, so the route may whitelist it.
+func (c *Client) Adopt(ctx context.Context, route, topic string) (*BlacklistEntry, error) {
+	return c.setOwner(ctx, route, topic, `adopt`)
+}
+
+// Release hands a blacklist entry to the operators, so the route never whitelists it.
+func (c *Client) Release(ctx context.Context, route, topic string) (*BlacklistEntry, error) {
+	return c.setOwner(ctx, route, topic, `release`)
+}
+
+func (c *Client) setOwner(ctx context.Context, route, topic, op string) (*BlacklistEntry, error) {
+	var entry BlacklistEntry
+	path := `/v1/routes/` + url.PathEscape(route) + `/blacklist/` + url.PathEscape(topic) + `/` + op
+	if err := c.do(ctx, http.MethodPost, path, nil, nil, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Leases returns the replication leases, for every route when route is empty.
+func (c *Client) Leases(ctx context.Context, route string) ([]Lease, error) {
+	var query url.Values
+	if route != "" {
+		query = url.Values{`route`: {route}}
+	}
+	var leases []Lease
+	if err := c.do(ctx, http.MethodGet, `/v1/leases`, query, nil, &leases); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+// StartLease whitelists a topic on a route until its lease expires.
+func (c *Client) StartLease(ctx context.Context, route string, req LeaseRequest) (*LeaseResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp LeaseResponse
+	if err := c.do(ctx, http.MethodPost, `/v1/routes/`+url.PathEscape(route)+`/leases`, nil, bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExtendLease extends the replication lease of a topic by ttl, a duration such as 72h.
+func (c *Client) ExtendLease(ctx context.Context, route, topic, ttl string) (*Lease, error) {
+	body, err := json.Marshal(struct {
+		TTL string `json:"ttl"`
+	}{TTL: ttl})
+	if err != nil {
+		return nil, err
+	}
+	var lease Lease
+	path := `/v1/routes/` + url.PathEscape(route) + `/leases/` + url.PathEscape(topic) + `/extend`
+	if err := c.do(ctx, http.MethodPost, path, nil, bytes.NewReader(body), &lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// Migrations returns the topic migrations known to the node, newest first.
+func (c *Client) Migrations(ctx context.Context) ([]Migration, error) {
+	var migrations []Migration
+	if err := c.do(ctx, http.MethodGet, `/v1/migrations`, nil, nil, &migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// Migration returns the status of a topic migration.
+func (c *Client) Migration(ctx context.Context, id string) (*Migration, error) {
+	var m Migration
+	if err := c.do(ctx, http.MethodGet, `/v1/migrations/`+url.PathEscape(id), nil, nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// StartMigration starts moving the replication of a topic between routes. The migration runs
+// in the background, follow it with Migration.
+func (c *Client) StartMigration(ctx context.Context, req MigrationRequest) (*Migration, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var m Migration
+	if err := c.do(ctx, http.MethodPost, `/v1/migrations`, nil, bytes.NewReader(body), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// AbortMigration stops a migration before it blacklists the topic on the old route. With
+// revert, the topic is blacklisted on the new route again when the migration whitelisted it.
+func (c *Client) AbortMigration(ctx context.Context, id string, revert bool) (*Migration, error) {
+	body, err := json.Marshal(struct {
+		Revert bool `json:"revert"`
+	}{Revert: revert})
+	if err != nil {
+		return nil, err
+	}
+	var m Migration
+	if err := c.do(ctx, http.MethodPost, `/v1/migrations/`+url.PathEscape(id)+`/abort`, nil, bytes.NewReader(body), &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Pending returns the topics awaiting confirmation, for every route when route is empty.
+func (c *Client) Pending(ctx context.Context, route string) ([]PendingCandidate, error) {
+	var query url.Values
+	if route != "" {
+		query = url.Values{`route`: {route}}
+	}
+	var candidates []PendingCandidate
+	if err := c.do(ctx, http.MethodGet, `/v1/pending`, query, nil, &candidates); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// Held returns the plans held for operator approval.
+func (c *Client) Held(ctx context.Context) ([]HeldPlan, error) {
+	var held []HeldPlan
+	if err := c.do(ctx, http.MethodGet, `/v1/held`, nil, nil, &held); err != nil {
+		return nil, err
+	}
+	return held, nil
+}
+
+// Approve approves the plan with the given ID held for a route, only the given topics of it
+// when any are given. The leader re-validates the approved actions before executing them.
+func (c *Client) Approve(ctx context.Context, route, id string, topics ...string) (*HeldPlan, error) {
+	body, err := json.Marshal(struct {
+		ID     string   `json:"id"`
+		Topics []string `json:"topics,omitempty"`
+	}{ID: id, Topics: topics})
+	if err != nil {
+		return nil, err
+	}
+	var held HeldPlan
+	if err := c.do(ctx, http.MethodPost, `/v1/routes/`+url.PathEscape(route)+`/approve`, nil, bytes.NewReader(body), &held); err != nil {
+		return nil, err
+	}
+	return &held, nil
+}
+
+// Settings returns the effective settings of every route.
+func (c *Client) Settings(ctx context.Context) ([]RouteSettings, error) {
+	var settings []RouteSettings
+	if err := c.do(ctx, http.MethodGet, `/v1/settings`, nil, nil, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// RouteSettings returns the effective settings of a route.
+func (c *Client) RouteSettings(ctx context.Context, route string) (*RouteSettings, error) {
+	var settings RouteSettings
+	if err := c.do(ctx, http.MethodGet, `/v1/routes/`+url.PathEscape(route)+`/settings`, nil, nil, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// HistoryQuery selects recorded reconcile runs. Zero values match everything.
+type HistoryQuery struct {
+	Route string
+	Topic string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// History returns the recorded reconcile runs matching q, newest first.
+func (c *Client) History(ctx context.Context, q HistoryQuery) ([]RunRecord, error) {
+	query := url.Values{}
+	if q.Route != "" {
+		query.Set(`route`, q.Route)
+	}
+	if q.Topic != "" {
+		query.Set(`topic`, q.Topic)
+	}
+	if !q.Since.IsZero() {
+		query.Set(`since`, q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		query.Set(`until`, q.Until.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		query.Set(`limit`, strconv.Itoa(q.Limit))
+	}
+	var records []RunRecord
+	if err := c.do(ctx, http.MethodGet, `/v1/history`, query, nil, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Rollback undoes the executed actions selected by req, or previews the undo when req.DryRun is set.
+func (c *Client) Rollback(ctx context.Context, req RollbackRequest) (*RollbackResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp RollbackResponse
+	if err := c.do(ctx, http.MethodPost, `/v1/rollback`, nil, bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Pause pauses scheduled reconciliation.
+func (c *Client) Pause(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, `/v1/pause`, nil, nil, nil)
+}
+
+// Resume resumes scheduled reconciliation.
+func (c *Client) Resume(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, `/v1/resume`, nil, nil, nil)
+}
+
+// Notify sends a leader value notification to a peer.
+func (c *Client) Notify(ctx context.Context, value, generation int, notifier string) error {
+	path := `/notify/` + strconv.Itoa(value) + `/` + strconv.Itoa(generation)
+	return c.do(ctx, http.MethodPost, path, url.Values{`notifier`: {notifier}}, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += `?` + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if c.token != "" {
+		req.Header.Set(`Authorization`, `Bearer `+c.token)
+	}
+	if body != nil {
+		req.Header.Set(`Content-Type`, `application/json`)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &e) == nil && e.Error != "" {
+			apiErr.Message = e.Error
+		}
+		return apiErr
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
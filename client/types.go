@@ -0,0 +1,341 @@
+package client
+
+import "time"
+
+// Status is the cluster membership and leader status of a node.
+type Status struct {
+	Node       string   `json:"node"`
+	Leader     string   `json:"leader"`
+	AmLeader   bool     `json:"amLeader"`
+	Generation int      `json:"generation"`
+	Paused     bool     `json:"paused"`
+	Members    []Member `json:"members"`
+}
+
+// Member is a serf cluster member.
+type Member struct {
+	Name   string `json:"name"`
+	Addr   string `json:"addr"`
+	Status string `json:"status"`
+}
+
+// RouteStatus is the outcome of the most recent reconcile of a route.
+type RouteStatus struct {
+	Name      string        `json:"name"`
+	LastRun   time.Time     `json:"lastRun"`
+	Duration  string        `json:"duration"`
+	Outcome   string        `json:"outcome"`
+	Error     string        `json:"error,omitempty"`
+	Executed  bool          `json:"executed"`
+	Deferred  string        `json:"deferred,omitempty"`
+	Blacklist []TopicReason `json:"blacklist"`
+	Whitelist []TopicReason `json:"whitelist"`
+	Expand    []TopicReason `json:"expand"`
+	Config    []TopicReason `json:"config"`
+	Onboard   []TopicReason `json:"onboard"`
+	Plan      *Plan         `json:"plan,omitempty"`
+}
+
+// TopicReason is a topic with the reason it was selected.
+type TopicReason struct {
+	Topic  string `json:"topic"`
+	Reason string `json:"reason"`
+}
+
+// Plan is the set of actions that reconciles a route.
+type Plan struct {
+	ID       string           `json:"id"`
+	Route    string           `json:"route"`
+	Mode     string           `json:"mode"`
+	Created  time.Time        `json:"created"`
+	Snapshot SnapshotCounts   `json:"snapshot"`
+	Actions  []PlanAction     `json:"actions"`
+	Deferred []PlanAction     `json:"deferred,omitempty"`
+	Excluded []PlanExclusion  `json:"excluded,omitempty"`
+	Breaker  string           `json:"breaker,omitempty"`
+	Drift    []PartitionDrift `json:"drift,omitempty"`
+	Configs  []ConfigDrift    `json:"configDrift,omitempty"`
+}
+
+// ConfigDrift is a topic config whose value differs between the source and destination.
+type ConfigDrift struct {
+	Topic       string `json:"topic"`
+	Config      string `json:"config"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// PartitionDrift is a replicated topic whose partition counts differ between the source,
+// uReplicator and the destination.
+type PartitionDrift struct {
+	Topic       string `json:"topic"`
+	Source      int    `json:"source"`
+	Replicated  int    `json:"replicated"`
+	Destination int    `json:"destination"`
+}
+
+// PlanExclusion is an action a route rule kept out of a Plan.
+type PlanExclusion struct {
+	Action  string `json:"action"`
+	Topic   string `json:"topic"`
+	Rule    string `json:"rule"`
+	Pattern string `json:"pattern"`
+}
+
+// SnapshotCounts summarizes the state a Plan was computed from.
+type SnapshotCounts struct {
+	ZKTopics   int `json:"zkTopics"`
+	Blacklist  int `json:"blacklist"`
+	SrcTopics  int `json:"srcTopics"`
+	DstTopics  int `json:"dstTopics"`
+	Replicated int `json:"replicated"`
+}
+
+// PlanAction is a single change a Plan makes to a route.
+type PlanAction struct {
+	Action     string            `json:"action"`
+	Topic      string            `json:"topic"`
+	Partitions int               `json:"partitions,omitempty"`
+	Reason     string            `json:"reason"`
+	Hold       string            `json:"hold,omitempty"`
+	Create     bool              `json:"create,omitempty"`
+	Configs    map[string]string `json:"configs,omitempty"`
+	Policy     string            `json:"policy,omitempty"`
+	// Lease marks the blacklist of a topic whose replication lease expired.
+	Lease bool `json:"lease,omitempty"`
+}
+
+// TopicExplanation is everything a route knows about one topic and the decision its planner makes.
+type TopicExplanation struct {
+	Route          string    `json:"route"`
+	Topic          string    `json:"topic"`
+	Taken          time.Time `json:"taken"`
+	Mode           string    `json:"mode"`
+	DeletionPolicy string    `json:"deletionPolicy"`
+	Registered     bool      `json:"registered"`
+	Blacklisted    bool      `json:"blacklisted"`
+	// Owner is who owns the topic's blacklist entry, skrr or operator.
+	Owner string `json:"owner,omitempty"`
+	Lease *Lease `json:"lease,omitempty"`
+	// ReplicatedPartitions is the partition count uReplicator has registered for the topic.
+	ReplicatedPartitions int             `json:"replicatedPartitions"`
+	Source               TopicPresence   `json:"source"`
+	Destination          TopicPresence   `json:"destination"`
+	Matches              []RuleMatch     `json:"matches,omitempty"`
+	Drift                *PartitionDrift `json:"drift,omitempty"`
+	ConfigDrift          []ConfigDrift   `json:"configDrift,omitempty"`
+	// Decision is the comma separated actions planned for the topic, excluded or none.
+	Decision string             `json:"decision"`
+	Reason   string             `json:"reason"`
+	Actions  []PlanAction       `json:"actions,omitempty"`
+	Excluded *PlanExclusion     `json:"excluded,omitempty"`
+	Pending  []PendingCandidate `json:"pending,omitempty"`
+}
+
+// TopicPresence is whether a topic exists on a Kafka cluster and with how many partitions.
+type TopicPresence struct {
+	Present    bool `json:"present"`
+	Partitions int  `json:"partitions"`
+}
+
+// RuleMatch is a route pattern matching a topic.
+type RuleMatch struct {
+	Rule    string `json:"rule"`
+	Pattern string `json:"pattern"`
+}
+
+// BlacklistEntry is a topic on a route's uReplicator blacklist and who owns it, skrr, operator,
+// migration or lease. Only entries owned by skrr are whitelisted automatically, and entries owned
+// by a migration or an expired lease never are.
+type BlacklistEntry struct {
+	Topic string    `json:"topic"`
+	Owner string    `json:"owner"`
+	Since time.Time `json:"since,omitempty"`
+	By    string    `json:"by,omitempty"`
+}
+
+// Lease is a topic whitelisted on a route until it expires, when the route blacklists it again.
+type Lease struct {
+	Route     string    `json:"route"`
+	Topic     string    `json:"topic"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"createdBy"`
+	Expires   time.Time `json:"expires"`
+	Extended  int       `json:"extended,omitempty"`
+	Notified  bool      `json:"notified,omitempty"`
+}
+
+// LeaseRequest whitelists a topic for TTL, a duration such as 336h. Partitions default to the
+// source partition count.
+type LeaseRequest struct {
+	Topic      string `json:"topic"`
+	TTL        string `json:"ttl"`
+	Partitions int    `json:"partitions,omitempty"`
+}
+
+// LeaseResponse is a lease and the results of the requests made to start it.
+type LeaseResponse struct {
+	Lease   Lease          `json:"lease"`
+	Results []ActionResult `json:"results"`
+}
+
+// MigrationRequest moves the replication of Topic from route From to route To. Partitions
+// default to the source partition count of the new route. Timeout is how long to wait for the
+// new route to replicate, the leader's default when empty.
+type MigrationRequest struct {
+	Topic      string `json:"topic"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Partitions int    `json:"partitions,omitempty"`
+	Timeout    string `json:"timeout,omitempty"`
+}
+
+// Migration is a job moving the replication of a topic between routes. The topic is added to
+// the new route, confirmed replicating there, then blacklisted on the old route.
+type Migration struct {
+	ID         string          `json:"id"`
+	Topic      string          `json:"topic"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Partitions int             `json:"partitions,omitempty"`
+	State      string          `json:"state"`
+	Created    time.Time       `json:"created"`
+	CreatedBy  string          `json:"createdBy"`
+	Updated    time.Time       `json:"updated"`
+	Timeout    string          `json:"timeout"`
+	Steps      []MigrationStep `json:"steps"`
+	Error      string          `json:"error,omitempty"`
+	AbortedBy  string          `json:"abortedBy,omitempty"`
+	Revert     bool            `json:"revert,omitempty"`
+	// Whitelisted reports the migration asked the new route to whitelist the topic.
+	Whitelisted bool `json:"whitelisted,omitempty"`
+}
+
+// MigrationStep is a step of a Migration, the outcome of its check and the requests it made.
+type MigrationStep struct {
+	Name     string         `json:"name"`
+	State    string         `json:"state"`
+	Check    string         `json:"check,omitempty"`
+	Started  time.Time      `json:"started,omitempty"`
+	Finished time.Time      `json:"finished,omitempty"`
+	Results  []ActionResult `json:"results,omitempty"`
+}
+
+// PendingCandidate is a topic awaiting confirmation before it qualifies for an action.
+type PendingCandidate struct {
+	Route     string    `json:"route"`
+	Topic     string    `json:"topic"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Cycles    int       `json:"cycles"`
+	Qualified bool      `json:"qualified"`
+}
+
+// HeldPlan is a Plan that was not executed and waits for operator approval. Only the Topics
+// approved are executed, every topic of the plan when none are given. Expires is zero when the
+// plan may be approved at any time.
+type HeldPlan struct {
+	ID         string    `json:"id"`
+	Route      string    `json:"route"`
+	Reason     string    `json:"reason"`
+	Held       time.Time `json:"held"`
+	Expires    time.Time `json:"expires"`
+	Approved   bool      `json:"approved"`
+	ApprovedBy string    `json:"approvedBy,omitempty"`
+	Topics     []string  `json:"topics,omitempty"`
+	Diff       []string  `json:"diff"`
+	Plan       Plan      `json:"plan"`
+}
+
+// RouteSettings are the effective settings of a route after applying its overrides.
+type RouteSettings struct {
+	Route    string   `json:"route"`
+	Interval string   `json:"interval"`
+	Timeout  string   `json:"timeout"`
+	Execute  bool     `json:"execute"`
+	Mode     string   `json:"mode"`
+	Windows  []string `json:"windows"`
+	Timezone string   `json:"timezone,omitempty"`
+	InWindow bool     `json:"inWindow"`
+	// NextWindow is the window open now, or the next to open. It is unset when the route has no windows.
+	NextWindow *WindowPeriod `json:"nextWindow,omitempty"`
+	Approval   bool          `json:"approval"`
+	LastRun    time.Time     `json:"lastRun"`
+	NextRun    time.Time     `json:"nextRun"`
+	Overrides  []string      `json:"overrides"`
+}
+
+// WindowPeriod is a single opening of a maintenance window.
+type WindowPeriod struct {
+	Window string    `json:"window"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// RunRecord is the recorded outcome of a single reconcile of a route.
+type RunRecord struct {
+	ID       string          `json:"id"`
+	Route    string          `json:"route"`
+	Leader   string          `json:"leader"`
+	Term     int             `json:"term"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Outcome  string          `json:"outcome"`
+	Executed bool            `json:"executed"`
+	Snapshot *SnapshotCounts `json:"snapshot,omitempty"`
+	Plan     *Plan           `json:"plan,omitempty"`
+	Results  []ActionResult  `json:"results,omitempty"`
+	Errors   []string        `json:"errors,omitempty"`
+}
+
+// ActionResult is the outcome of a single request made while executing a Plan.
+type ActionResult struct {
+	Action     string            `json:"action"`
+	Topic      string            `json:"topic"`
+	Partitions int               `json:"partitions,omitempty"`
+	Configs    map[string]string `json:"configs,omitempty"`
+	Time       time.Time         `json:"time"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	Response   string            `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Inverse    *InverseOp        `json:"inverse,omitempty"`
+}
+
+// InverseOp is the operation that undoes a successful ActionResult.
+type InverseOp struct {
+	Action     string            `json:"action"`
+	Topic      string            `json:"topic"`
+	Partitions int               `json:"partitions,omitempty"`
+	Configs    map[string]string `json:"configs,omitempty"`
+}
+
+// RollbackRequest selects executed actions to undo: every action of a run (Run), optionally
+// narrowed to one action (Topic and Action), or every action in a time window (Since, Until),
+// optionally narrowed to a Route, Topic or Action.
+type RollbackRequest struct {
+	Run    string    `json:"run,omitempty"`
+	Route  string    `json:"route,omitempty"`
+	Topic  string    `json:"topic,omitempty"`
+	Action string    `json:"action,omitempty"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	DryRun bool      `json:"dryRun"`
+}
+
+// RollbackStep is an inverse operation applied, or previewed, for an executed action.
+type RollbackStep struct {
+	Run     string        `json:"run"`
+	Route   string        `json:"route"`
+	Undoes  ActionResult  `json:"undoes"`
+	Inverse *InverseOp    `json:"inverse,omitempty"`
+	Result  *ActionResult `json:"result,omitempty"`
+	Skipped string        `json:"skipped,omitempty"`
+}
+
+// RollbackResponse lists the steps of a rollback, newest action first.
+type RollbackResponse struct {
+	DryRun bool           `json:"dryRun"`
+	Steps  []RollbackStep `json:"steps"`
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"regexp"
@@ -11,8 +12,22 @@ import (
 	"github.com/spf13/viper"
 )
 
+const (
+	defaultReplicationFactor = 3
+	defaultStateRoot         = `/skrr`
+)
+
 var performSilently bool
 
+// defaultDriftConfigs are the topic configs compared between source and destination.
+var defaultDriftConfigs = []string{
+	`retention.ms`,
+	`cleanup.policy`,
+	`max.message.bytes`,
+	`compression.type`,
+	`min.insync.replicas`,
+}
+
 // Config .
 type Config struct {
 	LogLevel string
@@ -27,6 +42,55 @@ type Cluster struct {
 	SourceBroker  string
 	ZKAddress     string
 	ZKRoot        string
+	// Confirmations is how many cycles a topic must be planned for before it is acted on. The
+	// count is kept in memory and starts over when another node becomes the leader.
+	Confirmations int
+	GracePeriod   time.Duration
+	Timeout       time.Duration
+
+	Reconcile time.Duration
+	Execute   bool
+	Mode      reconcileAction
+	Windows   []string
+	Timezone  string
+	windows   windowList
+	overrides []string
+
+	Approval    bool
+	ApprovalTTL time.Duration
+
+	MaxBlacklist        int
+	MaxBlacklistPercent float64
+	DeletionPolicy      string
+	// StatePath is the ZooKeeper path the route keeps its own state under, such as the
+	// blacklist entries it owns.
+	StatePath        string
+	WhitelistUnowned bool
+	// LeaseNotice is how long before a replication lease expires it is announced.
+	LeaseNotice time.Duration
+	// ConsumerGroup is the group the route's uReplicator workers commit source offsets as,
+	// used to confirm the route replicates a migrated topic.
+	ConsumerGroup string
+
+	CreateTopics      bool
+	ReplicationFactor int
+	TopicConfigs      []string
+
+	// DriftConfigs are the topic configs compared between source and destination. Drift is
+	// always reported, and only fixed with FixConfigDrift.
+	FixConfigDrift bool
+	DriftConfigs   []string
+
+	Include     []string
+	Exclude     []string
+	SettleDelay time.Duration
+	include     patternList
+	exclude     patternList
+
+	Protect []string
+	Ignore  []string
+	protect patternList
+	ignore  patternList
 }
 
 // Monitoring .
@@ -37,9 +101,50 @@ type Monitoring struct {
 	LeaderCheck time.Duration
 	PeerCheck   time.Duration
 	Reconcile   time.Duration
-	Execute     bool
-	Whitelist   bool
+	Workers     int
+	// RouteTimeout bounds a route reconcile unless the route sets its own timeout.
+	RouteTimeout time.Duration
+	Execute      bool
+	Whitelist    bool
+	Windows      []string
+	// Timezone is the IANA time zone windows are evaluated in, the local one when empty.
+	Timezone string
+	// LeaseNotice is how long before a replication lease expires it is announced, unless the
+	// route sets its own.
+	LeaseNotice time.Duration
+	// MigrationTimeout is how long a migration waits for the new route to replicate its topic.
+	MigrationTimeout time.Duration
+	// Approval holds every plan for operator approval before it is executed.
+	Approval bool
+	// ApprovalTTL is how long a held plan may be approved, forever when 0.
+	ApprovalTTL time.Duration
 	Peers       []string
+	DataDir     string
+	// HistoryRetention is how long reconcile history is kept, forever when 0.
+	HistoryRetention time.Duration
+	TLS              TLSConfig
+	Auth             AuthConfig
+}
+
+// AuthConfig configures token authentication for the API.
+type AuthConfig struct {
+	Enabled   bool
+	TokenFile string
+	// PeerToken authenticates leader notifications between nodes when TLS is disabled.
+	PeerToken string
+}
+
+// TLSConfig configures TLS for the API listener and mutual TLS between peers.
+type TLSConfig struct {
+	Enabled bool
+	// CertFile is presented to clients and to peers. Peers are dialed by the IP address they
+	// advertise in the cluster, so it needs an IP SAN for the address of each node, or peer
+	// verification fails.
+	CertFile string
+	KeyFile  string
+	ClientCA string
+	PeerCA   string
+	Reload   time.Duration
 }
 
 // GetConfig reads in the config file.
@@ -59,16 +164,54 @@ func GetConfig(filePath string) *Config {
 	viper.SetDefault(`monitor.leadercheck`, `1m`)
 	viper.SetDefault(`monitor.peercheck`, `2m`)
 	viper.SetDefault(`monitor.reconcile`, `5m`)
+	viper.SetDefault(`monitor.workers`, 4)
+	viper.SetDefault(`monitor.routetimeout`, `2m`)
+	viper.SetDefault(`monitor.tls.reload`, `1m`)
+	viper.SetDefault(`monitor.datadir`, `./data`)
+	viper.SetDefault(`monitor.historyretention`, `720h`)
+	viper.SetDefault(`monitor.approvalttl`, `1h`)
+	viper.SetDefault(`monitor.leasenotice`, `24h`)
+	viper.SetDefault(`monitor.migrationtimeout`, `30m`)
 	monitor := Monitoring{
-		BindAddress: viper.GetString(`monitor.bindaddress`),
-		BindPort:    viper.GetInt(`monitor.bindport`),
-		APIPort:     viper.GetString(`monitor.apiport`),
-		LeaderCheck: viper.GetDuration(`monitor.leadercheck`),
-		PeerCheck:   viper.GetDuration(`monitor.peercheck`),
-		Reconcile:   viper.GetDuration(`monitor.reconcile`),
-		Execute:     viper.GetBool(`monitor.execute`),
-		Whitelist:   viper.GetBool(`monitor.whitelist`),
-		Peers:       viper.GetStringSlice(`monitor.peers`),
+		BindAddress:  viper.GetString(`monitor.bindaddress`),
+		BindPort:     viper.GetInt(`monitor.bindport`),
+		APIPort:      viper.GetString(`monitor.apiport`),
+		LeaderCheck:  viper.GetDuration(`monitor.leadercheck`),
+		PeerCheck:    viper.GetDuration(`monitor.peercheck`),
+		Reconcile:    viper.GetDuration(`monitor.reconcile`),
+		Workers:      viper.GetInt(`monitor.workers`),
+		RouteTimeout: viper.GetDuration(`monitor.routetimeout`),
+		Execute:      viper.GetBool(`monitor.execute`),
+		Whitelist:    viper.GetBool(`monitor.whitelist`),
+		Windows:      viper.GetStringSlice(`monitor.windows`),
+		Timezone:     viper.GetString(`monitor.timezone`),
+		LeaseNotice:  viper.GetDuration(`monitor.leasenotice`),
+		Peers:        viper.GetStringSlice(`monitor.peers`),
+		DataDir:      viper.GetString(`monitor.datadir`),
+		Approval:     viper.GetBool(`monitor.approval`),
+		ApprovalTTL:  viper.GetDuration(`monitor.approvalttl`),
+
+		HistoryRetention: viper.GetDuration(`monitor.historyretention`),
+		MigrationTimeout: viper.GetDuration(`monitor.migrationtimeout`),
+		TLS: TLSConfig{
+			Enabled:  viper.GetBool(`monitor.tls.enabled`),
+			CertFile: viper.GetString(`monitor.tls.certfile`),
+			KeyFile:  viper.GetString(`monitor.tls.keyfile`),
+			ClientCA: viper.GetString(`monitor.tls.clientca`),
+			PeerCA:   viper.GetString(`monitor.tls.peerca`),
+			Reload:   viper.GetDuration(`monitor.tls.reload`),
+		},
+	}
+	monitor.Auth = AuthConfig{
+		Enabled:   viper.GetBool(`monitor.auth.enabled`),
+		TokenFile: viper.GetString(`monitor.auth.tokenfile`),
+		PeerToken: viper.GetString(`monitor.auth.peertoken`),
+	}
+	if monitor.Workers < 1 {
+		monitor.Workers = 1
+	}
+	if monitor.TLS.PeerCA == "" {
+		monitor.TLS.PeerCA = monitor.TLS.ClientCA
 	}
 	C.LogLevel = viper.GetString(`loglevel`)
 	C.Monitor = monitor
@@ -82,12 +225,170 @@ func GetConfig(filePath string) *Config {
 			SourceBroker:  c[`sourcebroker`],
 			ZKAddress:     c[`zkaddress`],
 			ZKRoot:        c[`zkroot`],
+			Confirmations: viper.GetInt(path + `.confirmations`),
+			GracePeriod:   viper.GetDuration(path + `.graceperiod`),
+			Timeout:       viper.GetDuration(path + `.timeout`),
+
+			MaxBlacklist:        viper.GetInt(path + `.maxblacklist`),
+			MaxBlacklistPercent: viper.GetFloat64(path + `.maxblacklistpercent`),
+			DeletionPolicy:      viper.GetString(path + `.deletionpolicy`),
+			StatePath:           viper.GetString(path + `.statepath`),
+			WhitelistUnowned:    viper.GetBool(path + `.whitelistunowned`),
+			LeaseNotice:         viper.GetDuration(path + `.leasenotice`),
+			ConsumerGroup:       viper.GetString(path + `.consumergroup`),
+
+			CreateTopics:      viper.GetBool(path + `.createtopics`),
+			ReplicationFactor: viper.GetInt(path + `.replicationfactor`),
+			TopicConfigs:      viper.GetStringSlice(path + `.topicconfigs`),
+
+			FixConfigDrift: viper.GetBool(path + `.fixconfigdrift`),
+			DriftConfigs:   viper.GetStringSlice(path + `.driftconfigs`),
+
+			Include:     viper.GetStringSlice(path + `.include`),
+			Exclude:     viper.GetStringSlice(path + `.exclude`),
+			SettleDelay: viper.GetDuration(path + `.settledelay`),
+
+			Protect: viper.GetStringSlice(path + `.protect`),
+			Ignore:  viper.GetStringSlice(path + `.ignore`),
+		}
+		cluster.include, err = compilePatterns(cluster.Include...)
+		if err != nil {
+			log.Fatalf("Invalid include pattern for %v: %v\n", l, err)
+		}
+		cluster.exclude, err = compilePatterns(cluster.Exclude...)
+		if err != nil {
+			log.Fatalf("Invalid exclude pattern for %v: %v\n", l, err)
+		}
+		cluster.protect, err = compilePatterns(cluster.Protect...)
+		if err != nil {
+			log.Fatalf("Invalid protect pattern for %v: %v\n", l, err)
+		}
+		cluster.ignore, err = compilePatterns(cluster.Ignore...)
+		if err != nil {
+			log.Fatalf("Invalid ignore pattern for %v: %v\n", l, err)
+		}
+		if cluster.Confirmations < 1 {
+			cluster.Confirmations = 1
+		}
+		if cluster.Timeout <= 0 {
+			cluster.Timeout = monitor.RouteTimeout
+		}
+		if cluster.LeaseNotice <= 0 {
+			cluster.LeaseNotice = monitor.LeaseNotice
+		}
+		if err := cluster.applyOverrides(path, monitor); err != nil {
+			log.Fatalf("Invalid settings for %v: %v\n", l, err)
+		}
+		switch cluster.DeletionPolicy {
+		case ``:
+			cluster.DeletionPolicy = policyBoth
+		case policyBoth, policySourceMissing, policyNever:
+		default:
+			log.Fatalf("Invalid deletion policy for %v: %v, expected one of %v, %v or %v\n", l, cluster.DeletionPolicy, policyBoth, policySourceMissing, policyNever)
+		}
+		if cluster.StatePath == "" {
+			cluster.StatePath = defaultStateRoot + `/` + l
+		}
+		if len(cluster.DriftConfigs) < 1 {
+			cluster.DriftConfigs = defaultDriftConfigs
+		}
+		if cluster.ReplicationFactor < 1 {
+			cluster.ReplicationFactor = defaultReplicationFactor
 		}
 		C.Clusters[l] = cluster
 	}
 	return &C
 }
 
+// applyOverrides sets the schedule and execution settings of a route, from its own config
+// where set and from monitor otherwise, recording which ones it overrides.
+func (c *Cluster) applyOverrides(path string, monitor Monitoring) error {
+	c.Reconcile = monitor.Reconcile
+	c.Execute = monitor.Execute
+	c.Mode = blacklistAction
+	if monitor.Whitelist {
+		c.Mode = bothAction
+	}
+	c.Windows = monitor.Windows
+	c.Timezone = monitor.Timezone
+	c.Approval = monitor.Approval
+	c.ApprovalTTL = monitor.ApprovalTTL
+	if viper.IsSet(path + `.reconcile`) {
+		c.Reconcile = viper.GetDuration(path + `.reconcile`)
+		c.overrides = append(c.overrides, `reconcile`)
+	}
+	if viper.IsSet(path + `.execute`) {
+		c.Execute = viper.GetBool(path + `.execute`)
+		c.overrides = append(c.overrides, `execute`)
+	}
+	if viper.IsSet(path + `.mode`) {
+		mode, err := parseAction(viper.GetString(path + `.mode`))
+		if err != nil {
+			return err
+		}
+		c.Mode = mode
+		c.overrides = append(c.overrides, `mode`)
+	}
+	if viper.IsSet(path + `.windows`) {
+		c.Windows = viper.GetStringSlice(path + `.windows`)
+		c.overrides = append(c.overrides, `windows`)
+	}
+	if viper.IsSet(path + `.timezone`) {
+		c.Timezone = viper.GetString(path + `.timezone`)
+		c.overrides = append(c.overrides, `timezone`)
+	}
+	if viper.IsSet(path + `.approval`) {
+		c.Approval = viper.GetBool(path + `.approval`)
+		c.overrides = append(c.overrides, `approval`)
+	}
+	if viper.IsSet(path + `.approvalttl`) {
+		c.ApprovalTTL = viper.GetDuration(path + `.approvalttl`)
+		c.overrides = append(c.overrides, `approvalttl`)
+	}
+	if c.Reconcile <= 0 {
+		return fmt.Errorf("reconcile interval must be positive")
+	}
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+		}
+	}
+	var err error
+	c.windows, err = parseWindows(loc, c.Windows...)
+	return err
+}
+
+// planRules returns the rules a route plans with, limited to the only patterns when any are given.
+func (c Cluster) planRules(only patternList) planRules {
+	return planRules{
+		Only:           only,
+		Protect:        c.protect,
+		Ignore:         c.ignore,
+		CreateMissing:  c.CreateTopics,
+		FixConfigs:     c.FixConfigDrift,
+		DeletionPolicy: c.DeletionPolicy,
+		Include:        c.include,
+		Exclude:        c.exclude,
+
+		WhitelistUnowned: c.WhitelistUnowned,
+	}
+}
+
+// checkExecute returns an error when the route may not change its replication at now, because
+// execute is off or no maintenance window is open. Requests made outside reconciles, such as
+// rollbacks, leases and migrations, are rejected with it.
+func (c Cluster) checkExecute(route string, now time.Time) error {
+	if !c.Execute {
+		return fmt.Errorf("route %v may not change: execute is off", route)
+	}
+	if deferral := c.windows.deferral(now); deferral != "" {
+		return fmt.Errorf("route %v may not change: %v", route, deferral)
+	}
+	return nil
+}
+
 func validateCluster(cluster Cluster) (good bool) {
 	switch {
 	case cluster.ReplAPI == "":
@@ -102,22 +403,34 @@ func validateCluster(cluster Cluster) (good bool) {
 	return true
 }
 
-func makeRegex(args ...string) *regexp.Regexp {
-	var regexString string
-	regexString += `^(`
-	switch {
-	case len(args) > 1:
-		first := args[0]
-		rest := args[1:]
-		regexString += first
-		for _, r := range rest {
-			regexString += `|` + r
-		}
-	case len(args) == 1:
-		regexString += args[0]
-	}
-	regexString += `)$`
-	return regexp.MustCompile(regexString)
+type topicPattern struct {
+	raw   string
+	regex *regexp.Regexp
+}
+
+// patternList is a set of user supplied topic patterns, each anchored to the whole topic name.
+type patternList []topicPattern
+
+func compilePatterns(patterns ...string) (patternList, error) {
+	list := make(patternList, 0, len(patterns))
+	for _, p := range patterns {
+		regex, err := regexp.Compile(`^(?:` + p + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic pattern %q: %v", p, err)
+		}
+		list = append(list, topicPattern{raw: p, regex: regex})
+	}
+	return list, nil
+}
+
+// match returns the first pattern matching topic.
+func (l patternList) match(topic string) (string, bool) {
+	for _, p := range l {
+		if p.regex.MatchString(topic) {
+			return p.raw, true
+		}
+	}
+	return "", false
 }
 
 func fileExists(filename string) bool {
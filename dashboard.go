@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// serveDashboard serves the embedded dashboard. The page itself is public, the data it
+// loads comes from the token protected API using the token entered in the page.
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(`Content-Type`, `text/html; charset=utf-8`)
+	fmt.Fprint(w, dashboardHTML)
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>skrr</title>
+<style>
+body { font-family: sans-serif; margin: 1.5em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.ok { color: #1a7f37; }
+.error, .invalid, .failed { color: #cf222e; }
+.muted { color: #888; }
+.diff { font-family: monospace; white-space: pre; }
+#auth { float: right; }
+button { margin-right: 0.4em; }
+</style>
+</head>
+<body>
+<div id="auth">
+<input id="token" type="password" placeholder="API token" size="24">
+<button onclick="saveToken()">Save</button>
+<span id="identity" class="muted"></span>
+</div>
+<h1>skrr</h1>
+<div id="message" class="error"></div>
+
+<h2>Cluster</h2>
+<p>Node: <b id="node"></b> &middot; Leader: <b id="leader"></b> &middot; Paused: <b id="paused"></b></p>
+<div id="actions"></div>
+<table id="members"><thead><tr><th>Member</th><th>Address</th><th>Status</th></tr></thead><tbody></tbody></table>
+
+<h2>Routes</h2>
+<table id="routes"><thead><tr><th>Route</th><th>Last Reconcile</th><th>Duration</th><th>Outcome</th><th>Executed</th><th>Error</th><th></th></tr></thead><tbody></tbody></table>
+
+<h2>Pending Topics</h2>
+<table id="pending"><thead><tr><th>Route</th><th>Set</th><th>Topic</th><th>Reason</th></tr></thead><tbody></tbody></table>
+
+<h2>Held Plans</h2>
+<table id="held"><thead><tr><th>Route</th><th>Plan</th><th>Reason</th><th>Changes</th><th>Held</th><th>Expires</th><th>Approved By</th><th></th></tr></thead><tbody></tbody></table>
+
+<h2>Awaiting Confirmation</h2>
+<table id="candidates"><thead><tr><th>Route</th><th>Set</th><th>Topic</th><th>Reason</th><th>First Seen</th><th>Cycles</th><th>Qualified</th></tr></thead><tbody></tbody></table>
+
+<h2>Live Events</h2>
+<table id="events"><thead><tr><th>Time</th><th>Type</th><th>Route</th><th>Topic</th><th>Message</th></tr></thead><tbody></tbody></table>
+
+<script>
+var stream, role;
+
+function token() { return localStorage.getItem('skrr-token') || ''; }
+function saveToken() { localStorage.setItem('skrr-token', document.getElementById('token').value); refresh(); follow(); }
+
+function follow() {
+  if (stream) { stream.close(); }
+  stream = new EventSource('/v1/events?token=' + encodeURIComponent(token()));
+  ['leader-change', 'member', 'reconcile-start', 'reconcile-finish', 'blacklist-request', 'blacklist-response',
+   'whitelist-request', 'whitelist-response', 'expand-request', 'expand-response',
+   'create-request', 'create-response', 'config-request', 'config-response', 'plan-held', 'lease-expiring', 'lease-expired', 'migration-step', 'migration-finish', 'error'].forEach(function(t) {
+    stream.addEventListener(t, function(msg) {
+      var e = JSON.parse(msg.data);
+      var body = document.querySelector('#events tbody');
+      var row = body.insertRow(0);
+      cell(row, new Date(e.time).toLocaleTimeString());
+      cell(row, e.type, e.type === 'error' ? 'error' : '');
+      cell(row, e.route || '');
+      cell(row, e.topic || '');
+      cell(row, e.message || '');
+      while (body.rows.length > 100) { body.deleteRow(-1); }
+    });
+  });
+}
+
+function api(method, path, body) {
+  var opts = {method: method, headers: {'Authorization': 'Bearer ' + token()}};
+  if (body) { opts.body = JSON.stringify(body); opts.headers['Content-Type'] = 'application/json'; }
+  return fetch(path, opts).then(function(r) {
+    return r.json().catch(function() { return {}; }).then(function(body) {
+      if (!r.ok) { throw new Error(body.error || (r.status + ' ' + r.statusText)); }
+      return body;
+    });
+  });
+}
+
+function cell(row, text, cls) {
+  var td = row.insertCell();
+  td.textContent = text;
+  if (cls) { td.className = cls; }
+  return td;
+}
+
+function fill(id, rows, render) {
+  var body = document.querySelector('#' + id + ' tbody');
+  body.innerHTML = '';
+  rows.forEach(function(r) { render(body.insertRow(), r); });
+}
+
+function act(method, path, body) {
+  api(method, path, body).then(refresh).catch(showError);
+}
+
+function showError(err) { document.getElementById('message').textContent = err.message; }
+
+function actions(role) {
+  var div = document.getElementById('actions');
+  div.innerHTML = '';
+  if (role !== 'operator') { return; }
+  [['Plan all', 'POST', '/v1/plan'], ['Reconcile all', 'POST', '/v1/reconcile'], ['Pause', 'POST', '/v1/pause'], ['Resume', 'POST', '/v1/resume']].forEach(function(a) {
+    div.appendChild(button(a[0], a[1], a[2]));
+  });
+}
+
+function button(label, method, path, body) {
+  var b = document.createElement('button');
+  b.textContent = label;
+  b.onclick = function() { act(method, path, body); };
+  return b;
+}
+
+function refresh() {
+  document.getElementById('message').textContent = '';
+  api('GET', '/v1/whoami').then(function(who) {
+    document.getElementById('identity').textContent = who.identity + ' (' + who.role + ')';
+    role = who.role;
+    actions(who.role);
+  }).catch(showError);
+  api('GET', '/v1/status').then(function(s) {
+    document.getElementById('node').textContent = s.node;
+    document.getElementById('leader').textContent = s.leader || 'unknown';
+    document.getElementById('paused').textContent = s.paused;
+    fill('members', s.members || [], function(row, m) {
+      cell(row, m.name); cell(row, m.addr); cell(row, m.status, m.status === 'alive' ? 'ok' : 'error');
+    });
+  }).catch(showError);
+  api('GET', '/v1/routes').then(function(routes) {
+    var pending = [];
+    fill('routes', routes, function(row, r) {
+      var never = r.lastRun.indexOf('0001-') === 0;
+      cell(row, r.name);
+      cell(row, never ? 'never' : new Date(r.lastRun).toLocaleString(), never ? 'muted' : '');
+      cell(row, r.duration || '');
+      cell(row, r.outcome || '', r.outcome);
+      cell(row, r.executed);
+      cell(row, r.error || '');
+      var td = row.insertCell();
+      if (role === 'operator') {
+        var base = '/v1/routes/' + encodeURIComponent(r.name);
+        td.appendChild(button('Plan', 'POST', base + '/plan'));
+        td.appendChild(button('Reconcile', 'POST', base + '/reconcile'));
+      }
+      (r.blacklist || []).forEach(function(t) { pending.push([r.name, 'blacklist', t.topic, t.reason]); });
+      (r.whitelist || []).forEach(function(t) { pending.push([r.name, 'whitelist', t.topic, t.reason]); });
+      (r.expand || []).forEach(function(t) { pending.push([r.name, 'expand', t.topic, t.reason]); });
+      (r.config || []).forEach(function(t) { pending.push([r.name, 'config', t.topic, t.reason]); });
+      (r.onboard || []).forEach(function(t) { pending.push([r.name, 'onboard', t.topic, t.reason]); });
+    });
+    fill('pending', pending, function(row, p) { p.forEach(function(v) { cell(row, v); }); });
+  }).catch(showError);
+  api('GET', '/v1/held').then(function(held) {
+    fill('held', held, function(row, h) {
+      cell(row, h.route); cell(row, h.id); cell(row, h.reason, 'error'); cell(row, (h.diff || []).join('\n'), 'diff');
+      cell(row, new Date(h.held).toLocaleString());
+      cell(row, new Date(h.expires).getFullYear() > 1 ? new Date(h.expires).toLocaleString() : 'never');
+      cell(row, h.approvedBy || '');
+      var td = row.insertCell();
+      if (role === 'operator' && !h.approved) {
+        td.appendChild(button('Approve', 'POST', '/v1/routes/' + encodeURIComponent(h.route) + '/approve', {id: h.id}));
+      }
+    });
+  }).catch(showError);
+  api('GET', '/v1/pending').then(function(candidates) {
+    fill('candidates', candidates, function(row, c) {
+      cell(row, c.route); cell(row, c.action); cell(row, c.topic); cell(row, c.reason);
+      cell(row, new Date(c.firstSeen).toLocaleString()); cell(row, c.cycles); cell(row, c.qualified);
+    });
+  }).catch(showError);
+}
+
+document.getElementById('token').value = token();
+refresh();
+follow();
+setInterval(refresh, 15000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"go.uber.org/zap"
+)
+
+const (
+	eventLeaderChange      = `leader-change`
+	eventMember            = `member`
+	eventReconcileStart    = `reconcile-start`
+	eventReconcileFinish   = `reconcile-finish`
+	eventBlacklistRequest  = `blacklist-request`
+	eventBlacklistResponse = `blacklist-response`
+	eventWhitelistRequest  = `whitelist-request`
+	eventWhitelistResponse = `whitelist-response`
+	eventExpandRequest     = `expand-request`
+	eventExpandResponse    = `expand-response`
+	eventCreateRequest     = `create-request`
+	eventCreateResponse    = `create-response`
+	eventConfigRequest     = `config-request`
+	eventConfigResponse    = `config-response`
+	eventPlanHeld          = `plan-held`
+	eventLeaseExpiring     = `lease-expiring`
+	eventLeaseExpired      = `lease-expired`
+	eventMigrationStep     = `migration-step`
+	eventMigrationFinish   = `migration-finish`
+	eventError             = `error`
+
+	eventHistorySize = 256
+	eventBufferSize  = 64
+
+	// eventsPath is the event stream, the only route accepting a token in its query string.
+	eventsPath = `/v1/events`
+)
+
+// Event is a structured notification of skrr activity.
+type Event struct {
+	ID      uint64                 `json:"id"`
+	Time    time.Time              `json:"time"`
+	Type    string                 `json:"type"`
+	Route   string                 `json:"route,omitempty"`
+	Topic   string                 `json:"topic,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+type eventBus struct {
+	lastID      uint64
+	history     []Event
+	subscribers map[chan Event]struct{}
+	mu          sync.Mutex
+}
+
+var events = &eventBus{
+	subscribers: make(map[chan Event]struct{}),
+}
+
+// publish stamps and fans out an event. Subscribers that are not keeping up miss events rather than block.
+func (b *eventBus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e.ID = b.lastID
+	e.Time = time.Now()
+	b.history = append(b.history, e)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of new events. When resuming, it also returns the retained events
+// after lastID, or all of them when lastID is ahead of the bus, as it was issued before the node
+// restarted.
+func (b *eventBus) subscribe(lastID uint64, resume bool) (chan Event, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, eventBufferSize)
+	b.subscribers[ch] = struct{}{}
+	if !resume {
+		return ch, nil
+	}
+	if lastID > b.lastID {
+		lastID = 0
+	}
+	var missed []Event
+	for _, e := range b.history {
+		if e.ID > lastID {
+			missed = append(missed, e)
+		}
+	}
+	return ch, missed
+}
+
+func (b *eventBus) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+func publishEvent(eventType, route, topic, message string, fields map[string]interface{}) {
+	events.publish(Event{
+		Type:    eventType,
+		Route:   route,
+		Topic:   topic,
+		Message: message,
+		Fields:  fields,
+	})
+}
+
+func publishError(route, topic, message string, err error) {
+	publishEvent(eventError, route, topic, message, map[string]interface{}{`error`: err.Error()})
+}
+
+// watchSerfEvents publishes serf membership events. It must keep draining the channel for serf to make progress.
+func watchSerfEvents(eventCh <-chan serf.Event) {
+	for e := range eventCh {
+		me, ok := e.(serf.MemberEvent)
+		if !ok {
+			continue
+		}
+		for _, m := range me.Members {
+			publishEvent(eventMember, "", "", me.EventType().String(), map[string]interface{}{
+				`member`: m.Name,
+				`addr`:   m.Addr.String(),
+				`status`: m.Status.String(),
+			})
+		}
+	}
+}
+
+// serveEvents streams events as server-sent events from the time of the request, first replaying
+// the retained events after Last-Event-ID when a reconnecting client sends one.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+	lastID, err := strconv.ParseUint(r.Header.Get(`Last-Event-ID`), 10, 64)
+	ch, missed := events.subscribe(lastID, err == nil)
+	defer events.unsubscribe(ch)
+
+	w.Header().Set(`Content-Type`, `text/event-stream`)
+	w.Header().Set(`Cache-Control`, `no-cache`)
+	w.Header().Set(`Connection`, `keep-alive`)
+	w.WriteHeader(http.StatusOK)
+	for _, e := range missed {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(time.Second * 30)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case e := <-ch:
+			writeEvent(w, e)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	j, err := json.Marshal(e)
+	if err != nil {
+		logger.Error("Error encoding event", zap.Error(err))
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, j)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventBusSubscribe(t *testing.T) {
+	b := &eventBus{subscribers: make(map[chan Event]struct{})}
+	for i := 0; i < 3; i++ {
+		b.publish(Event{Type: eventMember})
+	}
+	tests := []struct {
+		name   string
+		lastID uint64
+		resume bool
+		want   []uint64
+	}{
+		{name: `new subscriber`, want: nil},
+		{name: `resume`, lastID: 1, resume: true, want: []uint64{2, 3}},
+		{name: `resume up to date`, lastID: 3, resume: true, want: nil},
+		{name: `resume from the start`, lastID: 0, resume: true, want: []uint64{1, 2, 3}},
+		{name: `resume after restart`, lastID: 9, resume: true, want: []uint64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, missed := b.subscribe(tt.lastID, tt.resume)
+			defer b.unsubscribe(ch)
+			var got []uint64
+			for _, e := range missed {
+				got = append(got, e.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
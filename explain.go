@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const decisionNone = `none`
+
+// TopicExplanation is everything a route knows about one topic and the decision its planner makes.
+type TopicExplanation struct {
+	Route          string          `json:"route"`
+	Topic          string          `json:"topic"`
+	Taken          time.Time       `json:"taken"`
+	Mode           reconcileAction `json:"mode"`
+	DeletionPolicy string          `json:"deletionPolicy"`
+	Registered     bool            `json:"registered"`
+	Blacklisted    bool            `json:"blacklisted"`
+	// Owner is who owns the topic's blacklist entry, skrr, operator or migration.
+	Owner string `json:"owner,omitempty"`
+	Lease *Lease `json:"lease,omitempty"`
+	// ReplicatedPartitions is the partition count uReplicator has registered for the topic.
+	ReplicatedPartitions int             `json:"replicatedPartitions"`
+	Source               TopicPresence   `json:"source"`
+	Destination          TopicPresence   `json:"destination"`
+	Matches              []RuleMatch     `json:"matches,omitempty"`
+	Drift                *PartitionDrift `json:"drift,omitempty"`
+	ConfigDrift          []ConfigDrift   `json:"configDrift,omitempty"`
+	// Decision is the comma separated actions planned for the topic, excluded or none.
+	Decision string             `json:"decision"`
+	Reason   string             `json:"reason"`
+	Actions  []PlanAction       `json:"actions,omitempty"`
+	Excluded *PlanExclusion     `json:"excluded,omitempty"`
+	Pending  []PendingCandidate `json:"pending,omitempty"`
+}
+
+// TopicPresence is whether a topic exists on a Kafka cluster and with how many partitions.
+type TopicPresence struct {
+	Present    bool `json:"present"`
+	Partitions int  `json:"partitions"`
+}
+
+// RuleMatch is a route pattern matching a topic.
+type RuleMatch struct {
+	Rule    string `json:"rule"`
+	Pattern string `json:"pattern"`
+}
+
+// explainRoute snapshots a route and explains the decision its planner makes for topic.
+// Nothing is executed or pruned and no confirmation cycle is counted.
+func explainRoute(ctx context.Context, C Cluster, name, topic string) (TopicExplanation, error) {
+	ctx, cancel := context.WithTimeout(ctx, C.Timeout)
+	defer cancel()
+	rc := newRouteClient(name)
+	defer rc.close()
+	defer rc.closeOnDone(ctx)()
+	if err := rc.connect(C); err != nil {
+		return TopicExplanation{}, err
+	}
+	snap, err := rc.gatherSnapshot(C.ZKRoot, C.DriftConfigs...)
+	if err != nil {
+		return TopicExplanation{}, err
+	}
+	if _, err = rc.readOwnership(C.StatePath, &snap); err != nil {
+		return TopicExplanation{}, err
+	}
+	if snap.Leases, _, err = rc.readLeases(C.StatePath, snap); err != nil {
+		return TopicExplanation{}, err
+	}
+	e := explainTopic(snap, topic, C.Mode, C.planRules(nil))
+	for _, c := range pendingCandidates.list(name) {
+		if c.Topic == topic {
+			e.Pending = append(e.Pending, c)
+		}
+	}
+	return e, nil
+}
+
+// explainTopic plans a snapshot for a single topic and reports the state and rules behind the
+// decision: the action planned, the rule that excluded one, or why there is none.
+func explainTopic(snap Snapshot, topic string, mode reconcileAction, rules planRules) TopicExplanation {
+	e := TopicExplanation{
+		Route:                snap.Route,
+		Topic:                topic,
+		Taken:                snap.Taken,
+		Mode:                 mode,
+		DeletionPolicy:       rules.DeletionPolicy,
+		Registered:           newTopicSet(snap.ZKTopics...).has(topic),
+		Blacklisted:          newTopicSet(snap.Blacklist...).has(topic),
+		ReplicatedPartitions: snap.ReplPartitions[topic],
+		Source:               TopicPresence{Present: newTopicSet(snap.SrcTopics...).has(topic), Partitions: snap.SrcPartitions[topic]},
+		Destination:          TopicPresence{Present: newTopicSet(snap.DstTopics...).has(topic), Partitions: snap.DstPartitions[topic]},
+		Decision:             decisionNone,
+	}
+	for i, l := range snap.Leases {
+		if l.Topic == topic {
+			e.Lease = &snap.Leases[i]
+		}
+	}
+	if e.Blacklisted {
+		e.Owner = ownerOperator
+		switch {
+		case newTopicSet(snap.Migrated...).has(topic):
+			e.Owner = ownerMigration
+		case newTopicSet(snap.Expired...).has(topic):
+			e.Owner = ownerLease
+		case newTopicSet(snap.Owned...).has(topic):
+			e.Owner = ownerSkrr
+		}
+	}
+	for _, r := range []struct {
+		rule     string
+		patterns patternList
+	}{{ruleIgnore, rules.Ignore}, {ruleProtect, rules.Protect}, {`include`, rules.Include}, {`exclude`, rules.Exclude}} {
+		if p, ok := r.patterns.match(topic); ok {
+			e.Matches = append(e.Matches, RuleMatch{Rule: r.rule, Pattern: p})
+		}
+	}
+	rules.Only, _ = compilePatterns(regexp.QuoteMeta(topic))
+	plan := planReconcile(snap, mode, rules)
+	for i, d := range plan.Drift {
+		if d.Topic == topic {
+			e.Drift = &plan.Drift[i]
+		}
+	}
+	for _, c := range plan.Configs {
+		if c.Topic == topic {
+			e.ConfigDrift = append(e.ConfigDrift, c)
+		}
+	}
+	if len(plan.Actions) > 0 {
+		var decisions, reasons []string
+		for _, a := range plan.Actions {
+			decisions = append(decisions, a.Action.String())
+			reasons = append(reasons, a.Reason)
+		}
+		e.Actions = plan.Actions
+		e.Decision = strings.Join(decisions, `, `)
+		e.Reason = strings.Join(reasons, `; `)
+		return e
+	}
+	for i, x := range plan.Excluded {
+		if x.Topic == topic {
+			e.Excluded = &plan.Excluded[i]
+			e.Decision = `excluded`
+			e.Reason = fmt.Sprintf("would %v, kept out by %v %v", x.Action, x.Rule, x.Pattern)
+			return e
+		}
+	}
+	e.Reason = e.noActionReason(len(snap.Blacklist), rules)
+	if mode != bothAction {
+		if all := planReconcile(snap, bothAction, rules); len(all.Actions) > 0 {
+			e.Reason = fmt.Sprintf("%v, mode %v does not %v", all.Actions[0].Reason, mode, all.Actions[0].Action)
+		}
+	}
+	return e
+}
+
+// noActionReason describes why the planner leaves a topic as it is, given how many topics are blacklisted.
+func (e TopicExplanation) noActionReason(blacklisted int, rules planRules) string {
+	include, included := rules.Include.match(e.Topic)
+	exclude, excluded := rules.Exclude.match(e.Topic)
+	switch {
+	case e.Blacklisted && !e.Source.Present:
+		return `blacklisted and missing from source`
+	case e.Blacklisted && !e.Destination.Present:
+		return `blacklisted and missing from destination, topic creation is disabled`
+	case e.Blacklisted:
+		return `blacklisted`
+	case e.Registered && e.Source.Present && e.Destination.Present:
+		return `replicated and present in source and destination`
+	case e.Registered && e.Source.Present:
+		return `replicated and present in source, missing from destination`
+	case e.Registered && blacklisted < 1:
+		return `replicated but missing from source, topics are only blacklisted once the blacklist has an entry`
+	case e.Registered && e.Destination.Present:
+		return fmt.Sprintf("replicated and missing from source but present in destination, deletion policy %v requires it missing from both", rules.DeletionPolicy)
+	case e.Registered:
+		return `replicated and missing from source`
+	case !e.Source.Present:
+		return `not registered with uReplicator and missing from source`
+	case len(rules.Include) < 1:
+		return `present in source but not registered with uReplicator, the route has no include patterns`
+	case !included:
+		return `present in source but not registered with uReplicator and matches no include pattern`
+	case excluded:
+		return fmt.Sprintf("present in source but not registered with uReplicator, excluded by pattern %v", exclude)
+	case !e.Destination.Present:
+		return fmt.Sprintf("matches include pattern %v but is missing from destination, topic creation is disabled", include)
+	default:
+		return `not registered with uReplicator`
+	}
+}
@@ -3,6 +3,7 @@ module github.com/jbvmio/serfcluster
 go 1.12
 
 require (
+	github.com/Shopify/sarama v1.21.0
 	github.com/alex-laties/gokitzap v0.1.0
 	github.com/gorilla/mux v1.7.3
 	github.com/hashicorp/logutils v1.0.0
@@ -11,7 +12,7 @@ require (
 	github.com/jbvmio/zk v0.0.0-20190222142427-82e16500510c
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.8.1
-	github.com/samuel/go-zookeeper v0.0.0-20180130194729-c4fab1ac1bec // indirect
+	github.com/samuel/go-zookeeper v0.0.0-20180130194729-c4fab1ac1bec
 	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.4.0
 	go.uber.org/zap v1.10.0
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	historyFile   = `history.jsonl`
+	pruneInterval = time.Hour
+)
+
+// RunRecord is the durable record of a single reconcile of a route.
+type RunRecord struct {
+	ID       string          `json:"id"`
+	Route    string          `json:"route"`
+	Leader   string          `json:"leader"`
+	Term     int             `json:"term"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Outcome  string          `json:"outcome"`
+	Executed bool            `json:"executed"`
+	Snapshot *SnapshotCounts `json:"snapshot,omitempty"`
+	Plan     *Plan           `json:"plan,omitempty"`
+	Results  []ActionResult  `json:"results,omitempty"`
+	Errors   []string        `json:"errors,omitempty"`
+}
+
+// touches reports whether the run planned, deferred, excluded or executed anything for topic.
+func (r RunRecord) touches(topic string) bool {
+	for _, res := range r.Results {
+		if res.Topic == topic {
+			return true
+		}
+	}
+	if r.Plan == nil {
+		return false
+	}
+	for _, a := range r.Plan.Actions {
+		if a.Topic == topic {
+			return true
+		}
+	}
+	for _, a := range r.Plan.Deferred {
+		if a.Topic == topic {
+			return true
+		}
+	}
+	for _, e := range r.Plan.Excluded {
+		if e.Topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// historyFilter selects run records. Zero values match everything.
+type historyFilter struct {
+	Run   string
+	Route string
+	Topic string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (f historyFilter) match(r RunRecord) bool {
+	switch {
+	case f.Run != "" && r.ID != f.Run:
+		return false
+	case f.Route != "" && r.Route != f.Route:
+		return false
+	case !f.Since.IsZero() && r.Start.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && r.Start.After(f.Until):
+		return false
+	case f.Topic != "" && !r.touches(f.Topic):
+		return false
+	}
+	return true
+}
+
+// historyStore appends run records as JSON lines to a file in the data directory.
+type historyStore struct {
+	path      string
+	retention time.Duration
+	pruned    time.Time
+	mu        sync.Mutex
+}
+
+var runHistory *historyStore
+
+func openHistory(dir string, retention time.Duration) (*historyStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create data directory: %v", err)
+	}
+	h := &historyStore{
+		path:      filepath.Join(dir, historyFile),
+		retention: retention,
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open history: %v", err)
+	}
+	f.Close()
+	return h, h.prune(time.Now())
+}
+
+// record appends a run, pruning expired runs at most once per pruneInterval.
+// A nil store records nothing.
+func (h *historyStore) record(r RunRecord) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.append(r); err != nil {
+		logger.Error("Error recording reconcile history", zap.String("Cluster", r.Route), zap.Error(err))
+	}
+	if time.Since(h.pruned) >= pruneInterval {
+		if err := h.pruneLocked(time.Now()); err != nil {
+			logger.Error("Error pruning reconcile history", zap.Error(err))
+		}
+	}
+}
+
+func (h *historyStore) append(r RunRecord) error {
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(j, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// query returns the runs matching f, newest first.
+func (h *historyStore) query(f historyFilter) ([]RunRecord, error) {
+	records := []RunRecord{}
+	if h == nil {
+		return records, fmt.Errorf("history is not enabled")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	err := h.scan(func(r RunRecord) {
+		if f.match(r) {
+			records = append(records, r)
+		}
+	})
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if f.Limit > 0 && len(records) > f.Limit {
+		records = records[:f.Limit]
+	}
+	return records, err
+}
+
+// scan calls fn for every record in the file, oldest first, skipping lines that do not parse.
+func (h *historyStore) scan(fn func(RunRecord)) error {
+	return h.scanLines(func(line []byte) {
+		var r RunRecord
+		if err := json.Unmarshal(line, &r); err == nil {
+			fn(r)
+		}
+	})
+}
+
+func (h *historyStore) scanLines(fn func([]byte)) error {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (h *historyStore) prune(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pruneLocked(now)
+}
+
+// pruneLocked rewrites the file without the runs that ended before the retention period.
+// Lines that do not parse are kept.
+func (h *historyStore) pruneLocked(now time.Time) error {
+	h.pruned = now
+	if h.retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-h.retention)
+	var kept [][]byte
+	var dropped int
+	err := h.scanLines(func(line []byte) {
+		var r struct {
+			End time.Time `json:"end"`
+		}
+		if json.Unmarshal(line, &r) == nil && r.End.Before(cutoff) {
+			dropped++
+			return
+		}
+		kept = append(kept, line)
+	})
+	if err != nil || dropped < 1 {
+		return err
+	}
+	tmp := h.path + `.tmp`
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range kept {
+		if len(line) > 0 && line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		if _, err := w.Write(line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	logger.Info("Pruned reconcile history", zap.Int("Dropped", dropped), zap.Int("Kept", len(kept)), zap.Duration("Retention", h.retention))
+	return os.Rename(tmp, h.path)
+}
+
+// currentTerm returns the leader and generation of the leader value, if this node has one.
+func currentTerm() (string, int) {
+	if theOneAndOnlyNumber == nil {
+		return "", 0
+	}
+	_, gen, leader := theOneAndOnlyNumber.getValue()
+	return leader, gen
+}
+
+// recordOperation records requests made outside a reconcile, such as a lease or a migration, as an
+// executed run of a route so they show in the history and can be rolled back.
+func recordOperation(outcome, route string, start time.Time, results []ActionResult) RunRecord {
+	leader, term := currentTerm()
+	run := RunRecord{
+		ID:       fmt.Sprintf("%s-%s-%d", outcome, route, start.UnixNano()),
+		Route:    route,
+		Leader:   leader,
+		Term:     term,
+		Start:    start,
+		End:      time.Now(),
+		Outcome:  outcome,
+		Executed: true,
+		Results:  results,
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			run.Errors = append(run.Errors, fmt.Sprintf("%v %v: %v", r.Action, r.Topic, r.Error))
+		}
+	}
+	runHistory.record(run)
+	return run
+}
@@ -2,31 +2,197 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/Shopify/sarama"
 	"github.com/jbvmio/kafka"
+	"go.uber.org/zap"
 )
 
-var (
-	dstKafkaClient *kafka.KClient
-	srcKafkaClient *kafka.KClient
-)
+const describeBatchSize = 100
 
-func launchKafka(srcBroker, dstBroker string) error {
-	var err error
+func (rc *routeClient) launchKafka(srcBroker, dstBroker string) error {
 	conf := kafka.GetConf()
 	conf.Version = kafka.RecKafkaVersion
 	conf.ClientID = `skrr`
-	srcKafkaClient, err = kafka.NewCustomClient(conf, srcBroker)
+	src, err := kafka.NewCustomClient(conf, srcBroker)
 	if err != nil {
 		return fmt.Errorf("Error connecting to source kafka cluster: %v", err)
 	}
-	dstKafkaClient, err = kafka.NewCustomClient(conf, dstBroker)
+	dst, err := kafka.NewCustomClient(conf, dstBroker)
 	if err != nil {
+		src.Close()
 		return fmt.Errorf("Error connecting to destination kafka cluster: %v", err)
 	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed {
+		src.Close()
+		dst.Close()
+		return fmt.Errorf("route %v closed while connecting to kafka", rc.name)
+	}
+	rc.src, rc.dst = src, dst
 	return nil
 }
 
 func getKafkaTopics(client *kafka.KClient) ([]string, error) {
 	return client.ListTopics()
 }
+
+// createDestinationTopic creates topic on the destination cluster with the given partitions and
+// replication factor, copying the source values of the allowed config keys that are not defaults.
+func (rc *routeClient) createDestinationTopic(topic string, partitions, replication int, configKeys ...string) (map[string]string, error) {
+	copied := make(map[string]string)
+	entries := make(map[string]*string)
+	if len(configKeys) > 0 {
+		srcConfig, err := rc.src.GetTopicConfig(topic, configKeys...)
+		if err != nil {
+			return copied, fmt.Errorf("unable to read source topic config: %v", err)
+		}
+		for _, e := range srcConfig {
+			if e.Default || e.Sensitive {
+				continue
+			}
+			value := e.Value
+			entries[e.Name] = &value
+			copied[e.Name] = value
+		}
+	}
+	details := sarama.TopicDetail{
+		NumPartitions:     int32(partitions),
+		ReplicationFactor: int16(replication),
+		ConfigEntries:     entries,
+	}
+	if err := rc.dst.Admin().CreateTopic(topic, &details, false); err != nil {
+		return copied, fmt.Errorf("unable to create destination topic: %v", err)
+	}
+	return copied, nil
+}
+
+// describeTopicConfigs returns the values of the given config keys for each topic, described
+// from the controller in batches. Sensitive keys are left out, as their values are redacted and
+// alterDestinationConfig cannot copy them, so their drift could be neither seen nor fixed.
+func describeTopicConfigs(client *kafka.KClient, topics []string, configKeys ...string) (map[string]map[string]string, error) {
+	configs := make(map[string]map[string]string, len(topics))
+	if len(topics) < 1 || len(configKeys) < 1 {
+		return configs, nil
+	}
+	controller, err := client.Controller()
+	if err != nil {
+		return configs, err
+	}
+	for i := 0; i < len(topics); i += describeBatchSize {
+		end := i + describeBatchSize
+		if end > len(topics) {
+			end = len(topics)
+		}
+		var resources []*sarama.ConfigResource
+		for _, t := range topics[i:end] {
+			resources = append(resources, &sarama.ConfigResource{Type: sarama.TopicResource, Name: t, ConfigNames: configKeys})
+		}
+		resp, err := controller.DescribeConfigs(&sarama.DescribeConfigsRequest{Resources: resources})
+		if err != nil {
+			return configs, err
+		}
+		for _, r := range resp.Resources {
+			if r.ErrorMsg != "" {
+				logger.Warn("Unable to describe topic config", zap.String("Topic", r.Name), zap.String("Error", r.ErrorMsg))
+				continue
+			}
+			values := make(map[string]string, len(r.Configs))
+			for _, e := range r.Configs {
+				if e.Sensitive {
+					continue
+				}
+				values[e.Name] = e.Value
+			}
+			configs[r.Name] = values
+		}
+	}
+	return configs, nil
+}
+
+// alterDestinationConfig sets config values on a destination topic. AlterConfigs replaces every
+// override of a topic, so the existing non-default values are sent along with the changes. The
+// values of sensitive overrides are redacted and cannot be sent back, so a topic with any is
+// refused rather than having them wiped.
+func (rc *routeClient) alterDestinationConfig(topic string, values map[string]string) error {
+	current, err := rc.dst.GetTopicConfig(topic)
+	if err != nil {
+		return fmt.Errorf("unable to read destination topic config: %v", err)
+	}
+	entries := make(map[string]*string)
+	var sensitive []string
+	for _, e := range current {
+		switch {
+		case e.Default || e.ReadOnly:
+			continue
+		case e.Sensitive:
+			sensitive = append(sensitive, e.Name)
+			continue
+		}
+		value := e.Value
+		entries[e.Name] = &value
+	}
+	if len(sensitive) > 0 {
+		sort.Strings(sensitive)
+		return fmt.Errorf("destination topic %v has sensitive config overrides %v that altering its config would remove", topic, strings.Join(sensitive, `, `))
+	}
+	for k, v := range values {
+		value := v
+		entries[k] = &value
+	}
+	return rc.dst.Admin().AlterConfig(sarama.TopicResource, topic, entries, false)
+}
+
+// newestOffsets returns the sum of the newest offsets of a topic's partitions.
+func newestOffsets(client *kafka.KClient, topic string, partitions int) (int64, error) {
+	var sum int64
+	for p := 0; p < partitions; p++ {
+		offset, err := client.GetOffsetNewest(topic, int32(p))
+		if err != nil {
+			return 0, fmt.Errorf("unable to read newest offset of %v partition %v: %v", topic, p, err)
+		}
+		sum += offset
+	}
+	return sum, nil
+}
+
+// groupOffsets returns the offsets a consumer group committed for a topic's partitions on the
+// cluster at broker, -1 for partitions it never committed.
+func groupOffsets(broker, group, topic string, partitions int) (map[int32]int64, error) {
+	conf := kafka.GetConf()
+	conf.Version = kafka.RecKafkaVersion
+	conf.ClientID = `skrr`
+	client, err := sarama.NewClient([]string{broker}, conf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %v: %v", broker, err)
+	}
+	defer client.Close()
+	coordinator, err := client.Coordinator(group)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the coordinator of group %v: %v", group, err)
+	}
+	req := &sarama.OffsetFetchRequest{ConsumerGroup: group, Version: 1}
+	for p := 0; p < partitions; p++ {
+		req.AddPartition(topic, int32(p))
+	}
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch offsets of group %v: %v", group, err)
+	}
+	offsets := make(map[int32]int64, partitions)
+	for p := int32(0); p < int32(partitions); p++ {
+		offsets[p] = -1
+		block := resp.GetBlock(topic, p)
+		switch {
+		case block == nil:
+		case block.Err != sarama.ErrNoError:
+			return nil, fmt.Errorf("unable to fetch offset of group %v for %v partition %v: %v", group, topic, p, block.Err)
+		default:
+			offsets[p] = block.Offset
+		}
+	}
+	return offsets, nil
+}
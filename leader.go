@@ -1,9 +1,14 @@
 package main
 
 import (
-	"sort"
+	"context"
+	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/serf/serf"
 	"go.uber.org/zap"
@@ -11,23 +16,161 @@ import (
 
 type reconcileAction uint8
 
+// routeCloseGrace is how long a timed out reconcile is given to fail once its clients are closed.
+const routeCloseGrace = time.Second * 5
+
 const (
 	bothAction      reconcileAction = 0
 	blacklistAction reconcileAction = 1
 	whitelistAction reconcileAction = 2
+	expandAction    reconcileAction = 3
+	configAction    reconcileAction = 4
+	onboardAction   reconcileAction = 5
+	createAction    reconcileAction = 6
+)
+
+var (
+	reconcileNow = make(chan reconcileRequest, 1)
+	paused       int32
+	leading      int32
+	inflight     = &inflightRoutes{routes: make(map[string]bool)}
 )
 
-var performAction = blacklistAction
+// inflightRoutes holds the routes with a reconcile still running, including one abandoned
+// after its timeout, so a route is never reconciled twice at once.
+type inflightRoutes struct {
+	routes map[string]bool
+	mu     sync.Mutex
+}
+
+// begin marks a route as reconciling, returning false if it already is.
+func (r *inflightRoutes) begin(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routes[name] {
+		return false
+	}
+	r.routes[name] = true
+	return true
+}
+
+func (r *inflightRoutes) end(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.routes, name)
+}
+
+// amLeader reports whether this node is the leader. It is read by reconciles, API handlers
+// and migrations while the leader check changes it.
+func amLeader() bool {
+	return atomic.LoadInt32(&leading) == 1
+}
+
+func setLeader(leader bool) {
+	var val int32
+	if leader {
+		val = 1
+	}
+	atomic.StoreInt32(&leading, val)
+}
+
+func isPaused() bool {
+	return atomic.LoadInt32(&paused) == 1
+}
+
+func setPaused(pause bool) {
+	var val int32
+	if pause {
+		val = 1
+	}
+	atomic.StoreInt32(&paused, val)
+}
+
+// reconcileRequest is an on demand reconcile. An empty Route reconciles every route. DryRun only
+// plans, regardless of the execute setting, without counting confirmation cycles. Scheduled
+// requests only reconcile the routes whose interval has passed. Confirmation cycles are counted
+// in memory by the leader, so they start over when leadership moves to another node.
+type reconcileRequest struct {
+	Identity  string
+	Route     string
+	DryRun    bool
+	Scheduled bool
+}
+
+// requestReconcile queues a reconcile, returning false if one is already queued.
+func requestReconcile(req reconcileRequest) bool {
+	select {
+	case reconcileNow <- req:
+		return true
+	default:
+		return false
+	}
+}
 
-func leaderWork(config *Config, cluster *serf.Serf) {
+func leaderWork(config *Config, cluster *serf.Serf, req reconcileRequest) {
 	_, _, leader := theOneAndOnlyNumber.getValue()
 	if leader == cluster.LocalMember().Name {
-		logger.Debug("I AM LEADER", zap.String("ME", cluster.LocalMember().Name), zap.Bool("AM Leader", amLeader))
-		logger.Info("Beginning Reconcile Work", zap.String("Leader", cluster.LocalMember().Name))
+		logger.Debug("I AM LEADER", zap.String("ME", cluster.LocalMember().Name), zap.Bool("AM Leader", amLeader()))
+		logger.Info("Beginning Reconcile Work", zap.String("Leader", cluster.LocalMember().Name), zap.Int("Workers", config.Monitor.Workers))
+		workers := make(chan struct{}, config.Monitor.Workers)
+		var wg sync.WaitGroup
+		now := time.Now()
 		for name, cluster := range config.Clusters {
-			logger.Info("Reconciling Cluster", zap.String("Cluster", name))
-			reconcileTopics(cluster, name, performAction, config.Monitor.Execute)
+			if req.Route != "" && req.Route != name {
+				continue
+			}
+			if req.Scheduled && !routeSchedule.due(name, cluster.Reconcile, now) {
+				continue
+			}
+			wg.Add(1)
+			workers <- struct{}{}
+			go func(name string, C Cluster) {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				execute := C.Execute && !req.DryRun
+				logger.Info("Reconciling Cluster", zap.String("Cluster", name), zap.Bool("DryRun", req.DryRun), zap.Bool("Execute", execute))
+				reconcileRoute(C, name, C.Mode, execute, req.DryRun)
+			}(name, cluster)
+		}
+		wg.Wait()
+	}
+}
+
+// reconcileRoute reconciles a route within its timeout. A reconcile still running when the timeout
+// passes has its clients closed and is no longer waited on, so a hung cluster only holds up its own route.
+// The route is skipped until that reconcile returns.
+func reconcileRoute(C Cluster, replName string, action reconcileAction, execute, dryRun bool, args ...string) {
+	if !inflight.begin(replName) {
+		logger.Warn("Skipping route reconcile, a previous reconcile is still running", zap.String("Cluster", replName))
+		publishEvent(eventError, replName, "", "Skipping route reconcile, a previous reconcile is still running", nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), C.Timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer inflight.end(replName)
+		defer close(done)
+		reconcileTopics(ctx, C, replName, action, execute, dryRun, args...)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		select {
+		case <-done:
+			return
+		case <-time.After(routeCloseGrace):
 		}
+		logger.Error("Route reconcile timed out", zap.String("Cluster", replName), zap.Duration("Timeout", C.Timeout))
+		publishError(replName, "", "Route reconcile timed out", ctx.Err())
+		routeStatuses.set(RouteStatus{
+			Name:    replName,
+			LastRun: time.Now().Add(-C.Timeout),
+			Outcome: outcomeError,
+			Error:   fmt.Sprintf("reconcile timed out after %v", C.Timeout),
+		})
 	}
 }
 
@@ -54,99 +197,231 @@ func leaderCheck(cluster *serf.Serf) {
 	curVal, _, _ := theOneAndOnlyNumber.getValue()
 	if curVal != highestVal {
 		logger.Info("Changing Leader", zap.String("New Leader", highestNode))
+		publishEvent(eventLeaderChange, "", "", "Changing Leader", map[string]interface{}{`leader`: highestNode, `score`: highestVal})
 		if highestNode == cluster.LocalMember().Name {
 			theOneAndOnlyNumber.setValue(highestVal, highestNode)
-			amLeader = true
-			logger.Info("I am the new leader", zap.String("Node", cluster.LocalMember().Name), zap.Bool("Leader", amLeader))
+			setLeader(true)
+			logger.Info("I am the new leader", zap.String("Node", cluster.LocalMember().Name), zap.Bool("Leader", amLeader()))
 		} else {
-			amLeader = false
-			logger.Info("I am not the new leader", zap.String("Node", cluster.LocalMember().Name), zap.Bool("Leader", amLeader))
+			setLeader(false)
+			logger.Info("I am not the new leader", zap.String("Node", cluster.LocalMember().Name), zap.Bool("Leader", amLeader()))
 		}
 	}
 }
 
-func reconcileTopics(C Cluster, replName string, action reconcileAction, execute bool, args ...string) {
-	if (C == Cluster{}) {
+// reconcileTopics plans a route and executes the plan when execute is set. A dry run previews
+// which candidates qualify without counting the cycle towards their confirmations.
+func reconcileTopics(ctx context.Context, C Cluster, replName string, action reconcileAction, execute, dryRun bool, args ...string) {
+	status := RouteStatus{
+		Name:     replName,
+		LastRun:  time.Now(),
+		Outcome:  outcomeOK,
+		Executed: execute,
+	}
+	var results []ActionResult
+	publishEvent(eventReconcileStart, replName, "", "Reconciling Cluster", map[string]interface{}{`execute`: execute})
+	defer func() {
+		end := time.Now()
+		status.Duration = end.Sub(status.LastRun).String()
+		if ctx.Err() != nil {
+			// Keep the timeout reconcileRoute reported, along with what was done before it.
+			status.Outcome = outcomeError
+			status.Error = fmt.Sprintf("reconcile timed out after %v", C.Timeout)
+		}
+		routeStatuses.set(status)
+		recordRun(status, end, results)
+		publishEvent(eventReconcileFinish, replName, "", status.Outcome, map[string]interface{}{
+			`duration`:  status.Duration,
+			`executed`:  status.Executed,
+			`blacklist`: len(status.Blacklist),
+			`whitelist`: len(status.Whitelist),
+			`expand`:    len(status.Expand),
+			`config`:    len(status.Config),
+			`onboard`:   len(status.Onboard),
+			`error`:     status.Error,
+		})
+	}()
+	if reflect.DeepEqual(C, Cluster{}) {
 		logger.Error("Could not reconcile cluster!", zap.String("reason", "Invalid Configuration"), zap.String("Cluster", replName))
 	}
-	ok := validateCluster(C)
-	if ok {
-		var errCount int
-		targetTopics := make(map[reconcileAction][]string)
-		kafErr := launchKafka(C.SourceBroker, C.BrokerAddress)
-		defer func() {
-			if kafErr == nil {
-				srcKafkaClient.Close()
-				dstKafkaClient.Close()
-			}
-		}()
-		err := launchZKClient(C.ZKAddress)
-		if err != nil {
-			logger.Error("Error connecting to ZooKeeper", zap.String("Address", C.ZKAddress), zap.Error(err))
-			errCount++
+	only, err := compilePatterns(args...)
+	if err != nil {
+		logger.Error("Could not reconcile cluster!", zap.String("reason", "Invalid Topic Pattern"), zap.String("Cluster", replName), zap.Error(err))
+		status.Outcome = outcomeInvalid
+		status.Error = err.Error()
+		publishError(replName, "", "Could not reconcile cluster!", err)
+		return
+	}
+	if !validateCluster(C) {
+		logger.Error("Could not reconcile cluster!", zap.String("reason", "Validation Checks Failed"), zap.String("Cluster", replName))
+		status.Outcome = outcomeInvalid
+		status.Error = "Validation Checks Failed"
+		publishEvent(eventError, replName, "", "Could not reconcile cluster!", map[string]interface{}{`error`: status.Error})
+		return
+	}
+	var errCount int
+	rc := newRouteClient(replName)
+	defer rc.close()
+	defer rc.closeOnDone(ctx)()
+	kafErr := rc.launchKafka(C.SourceBroker, C.BrokerAddress)
+	if kafErr != nil {
+		logger.Error("Error connecting to Kafka", zap.String("Cluster", replName), zap.Error(kafErr))
+		status.Error = kafErr.Error()
+		publishError(replName, "", "Error connecting to Kafka", kafErr)
+		errCount++
+	}
+	err = rc.launchZKClient(C.ZKAddress)
+	if err != nil {
+		logger.Error("Error connecting to ZooKeeper", zap.String("Address", C.ZKAddress), zap.Error(err))
+		status.Error = err.Error()
+		publishError(replName, "", "Error connecting to ZooKeeper", err)
+		errCount++
+	}
+	err = rc.getZKTarget(C.ZKRoot, replName)
+	if err != nil {
+		logger.Error("Error validating ZooKeeper", zap.String("ZKRoot", C.ZKRoot), zap.String("Cluster", replName), zap.Error(err))
+		status.Error = err.Error()
+		publishError(replName, "", "Error validating ZooKeeper", err)
+		errCount++
+	}
+	if errCount > 0 {
+		logger.Error("Could not reconcile topics, too many errors")
+		status.Outcome = outcomeError
+		return
+	}
+	snap, err := rc.gatherSnapshot(C.ZKRoot, C.DriftConfigs...)
+	if err != nil {
+		logger.Error("Could not reconcile topics, unable to snapshot route", zap.String("Cluster", replName), zap.Error(err))
+		status.Outcome = outcomeError
+		status.Error = err.Error()
+		publishError(replName, "", "Unable to snapshot route", err)
+		return
+	}
+	staleOwned, err := rc.readOwnership(C.StatePath, &snap)
+	if err != nil {
+		logger.Warn("Unable to read blacklist ownership, no blacklist entry is owned", zap.String("Cluster", replName), zap.Error(err))
+	}
+	var endedLeases []Lease
+	if snap.Leases, endedLeases, err = rc.readLeases(C.StatePath, snap); err != nil {
+		logger.Warn("Unable to read replication leases, none will expire", zap.String("Cluster", replName), zap.Error(err))
+	}
+	if !planOnly {
+		rc.notifyLeases(C.StatePath, snap.Leases, C.LeaseNotice, snap.Taken)
+	}
+	plan := planReconcile(snap, action, C.planRules(only))
+	var ready, held []PlanAction
+	if dryRun {
+		ready, held = pendingCandidates.preview(replName, plan.Actions, C.Confirmations, C.GracePeriod, C.SettleDelay, plan.Created)
+	} else {
+		ready, held = pendingCandidates.observe(replName, plan.Actions, only, C.Confirmations, C.GracePeriod, C.SettleDelay, plan.Created)
+	}
+	plan.Actions, plan.Deferred = append([]PlanAction{}, ready...), held
+	plan.ID = plan.fingerprint()
+	plan.Breaker = blastRadius(plan, C.MaxBlacklist, C.MaxBlacklistPercent)
+	status.Plan = &plan
+	status.Blacklist = plan.reasons(blacklistAction)
+	status.Whitelist = plan.reasons(whitelistAction)
+	status.Expand = plan.reasons(expandAction)
+	status.Config = plan.reasons(configAction)
+	status.Onboard = plan.reasons(onboardAction)
+	if execute && !C.windows.open(plan.Created) {
+		execute = false
+		status.Executed = false
+		deferral := C.windows.deferral(plan.Created)
+		if len(plan.Actions) > 0 {
+			status.Outcome = outcomeDeferred
+			status.Deferred = deferral
 		}
-		err = getZKTarget(C.ZKRoot, replName)
+		logger.Info("Outside maintenance windows, deferring execution", zap.String("Cluster", replName), zap.Strings("Windows", C.Windows), zap.String("Deferred", deferral))
+	}
+	logPlan(plan, execute)
+	if !execute {
+		return
+	}
+	if err := ctx.Err(); err != nil {
+		logger.Error("Refusing to execute plan, reconcile timed out", zap.String("Cluster", replName), zap.String("Plan", plan.ID))
+		status.Outcome = outcomeError
+		status.Error = err.Error()
+		status.Executed = false
+		return
+	}
+	approved := plan
+	if plan.Breaker != "" || (C.Approval && len(plan.Actions) > 0) {
+		h, ok, err := heldPlans.approval(C, replName, plan.Created)
 		if err != nil {
-			logger.Error("Error validating ZooKeeper", zap.String("ZKRoot", C.ZKRoot), zap.String("Cluster", replName), zap.Error(err))
-			errCount++
+			logger.Error("Refusing to execute plan, unable to read held plan", zap.String("Cluster", replName), zap.String("Plan", plan.ID), zap.Error(err))
+			publishError(replName, "", "Unable to read held plan", err)
+			status.Outcome = outcomeError
+			status.Error = err.Error()
+			status.Executed = false
+			return
 		}
-		switch {
-		case errCount > 0:
-			logger.Error("Could not reconcile topics, too many errors")
-		default:
-			switch action {
-			case bothAction:
-				targetTopics[blacklistAction] = filterDeletedTopics(C.ZKRoot)
-				targetTopics[whitelistAction] = filterReAddedTopics(C.ZKRoot)
-				sort.SliceStable(targetTopics[blacklistAction], func(i, j int) bool { return targetTopics[blacklistAction][i] < targetTopics[blacklistAction][j] })
-				sort.SliceStable(targetTopics[whitelistAction], func(i, j int) bool { return targetTopics[whitelistAction][i] < targetTopics[whitelistAction][j] })
-			case whitelistAction:
-				targetTopics[whitelistAction] = filterReAddedTopics(C.ZKRoot)
-				sort.SliceStable(targetTopics[whitelistAction], func(i, j int) bool { return targetTopics[whitelistAction][i] < targetTopics[whitelistAction][j] })
-			default:
-				targetTopics[blacklistAction] = filterDeletedTopics(C.ZKRoot)
-				sort.SliceStable(targetTopics[blacklistAction], func(i, j int) bool { return targetTopics[blacklistAction][i] < targetTopics[blacklistAction][j] })
+		if !ok {
+			reason := plan.Breaker
+			if reason == "" {
+				reason = reasonApproval
 			}
-			if len(args) > 0 {
-				for k := range targetTopics {
-					targetTopics[k] = filterArgsTopics(args, targetTopics[k])
-				}
+			held, err := heldPlans.hold(C, plan, reason, C.ApprovalTTL, plan.Created)
+			if err != nil {
+				logger.Error("Refusing to execute plan, unable to hold it for approval", zap.String("Cluster", replName), zap.String("Plan", plan.ID), zap.Error(err))
+				publishError(replName, "", "Unable to hold plan for approval", err)
+				status.Outcome = outcomeError
+				status.Error = err.Error()
+				status.Executed = false
+				return
 			}
-			for action, topics := range targetTopics {
-				var finalStr string
-				L := logger.With(zap.String("Cluster", replName),
-					zap.Uint8("ReconcileAction", uint8(performAction)),
-					zap.Bool("Perform Execution", execute))
-				switch action {
-				case blacklistAction:
-					switch {
-					case len(topics) < 1:
-						L.Info("No topics need blacklist reconciliation")
-						continue
-					case execute:
-						L.Info("Blacklisting Topics ...")
-						blacklistTopics(C.ReplAPI, topics...)
-						continue
-					default:
-						finalStr = "Topics replicated but not available"
-					}
-				case whitelistAction:
-					switch {
-					case len(topics) < 1:
-						L.Info("No topics need whitelist reconciliation.")
-						continue
-					case execute:
-						L.Info("Whitelisting Topics ...")
-						whitelistTopics(C.ReplAPI, topics...)
-						continue
-					default:
-						finalStr = "Topics available but not replicated"
-					}
-				}
-				L.Info(finalStr, zap.Strings("Topics", topics))
+			if plan.Breaker != "" {
+				logger.Error("Refusing to execute plan, blast radius exceeded", zap.String("Cluster", replName), zap.String("Plan", plan.ID), zap.String("Reason", plan.Breaker))
+				publishEvent(eventError, replName, "", "Blast radius exceeded, plan held for approval", map[string]interface{}{`plan`: held.ID, `reason`: held.Reason})
+			} else {
+				logger.Info("Plan held for approval", zap.String("Cluster", replName), zap.String("Plan", plan.ID), zap.Int("Actions", len(plan.Actions)))
+				publishEvent(eventPlanHeld, replName, "", "Plan held for approval", map[string]interface{}{`plan`: held.ID, `diff`: held.Diff, `expires`: held.Expires})
 			}
+			status.Outcome = outcomeHeld
+			status.Executed = false
+			return
+		}
+		var stale []PlanAction
+		approved.Actions, stale = h.revalidate(plan)
+		for _, a := range stale {
+			logger.Warn("Dropping approved action no longer planned", zap.String("Cluster", replName), zap.String("Plan", h.ID), zap.String("Action", a.Action.String()), zap.String("Topic", a.Topic))
+		}
+		logger.Info("Executing approved plan", zap.String("Cluster", replName), zap.String("Plan", h.ID), zap.String("Identity", h.ApprovedBy), zap.Int("Actions", len(approved.Actions)), zap.Int("Stale", len(stale)))
+	}
+	rc.pruneOwnership(C.StatePath, staleOwned)
+	rc.pruneLeases(C.StatePath, endedLeases)
+	results = rc.executePlan(ctx, C, approved)
+	if err := heldPlans.release(C, replName); err != nil {
+		logger.Warn("Unable to release held plan", zap.String("Cluster", replName), zap.Error(err))
+	}
+}
+
+// recordRun writes the outcome of a reconcile to the history store.
+func recordRun(status RouteStatus, end time.Time, results []ActionResult) {
+	leader, term := currentTerm()
+	run := RunRecord{
+		ID:       fmt.Sprintf("%s-%d", status.Name, status.LastRun.UnixNano()),
+		Route:    status.Name,
+		Leader:   leader,
+		Term:     term,
+		Start:    status.LastRun,
+		End:      end,
+		Outcome:  status.Outcome,
+		Executed: status.Executed,
+		Plan:     status.Plan,
+		Results:  results,
+	}
+	if status.Plan != nil {
+		counts := status.Plan.Snapshot
+		run.Snapshot = &counts
+	}
+	if status.Error != "" {
+		run.Errors = append(run.Errors, status.Error)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			run.Errors = append(run.Errors, fmt.Sprintf("%v %v: %v", r.Action, r.Topic, r.Error))
 		}
-	} else {
-		logger.Error("Could not reconcile cluster!", zap.String("reason", "Validation Checks Failed"), zap.String("Cluster", replName))
 	}
+	runHistory.record(run)
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestReconcileRouteSkipsInflight(t *testing.T) {
+	logger = zap.NewNop()
+	if !inflight.begin(`atl-atl`) {
+		t.Fatalf("route already reconciling")
+	}
+	defer inflight.end(`atl-atl`)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reconcileRoute(Cluster{Timeout: time.Minute}, `atl-atl`, bothAction, false, true)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reconcile of a route already reconciling did not return")
+	}
+	if inflight.begin(`atl-atl`) {
+		t.Errorf("skipped reconcile released the route")
+	}
+}
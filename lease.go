@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	gozk "github.com/samuel/go-zookeeper/zk"
+	"go.uber.org/zap"
+)
+
+const (
+	// leasePath holds a node per leased topic, under a route's state path.
+	leasePath = `/leases`
+
+	outcomeLease       = `lease`
+	reasonLeaseExpired = `replication lease expired at %v`
+)
+
+// Lease is a topic whitelisted on a route until it expires, when the route blacklists it again.
+type Lease struct {
+	Route     string    `json:"route"`
+	Topic     string    `json:"topic"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"createdBy"`
+	Expires   time.Time `json:"expires"`
+	Extended  int       `json:"extended,omitempty"`
+	Notified  bool      `json:"notified,omitempty"`
+}
+
+// LeaseRequest whitelists a topic for TTL, a duration such as 336h. Partitions default to the
+// source partition count.
+type LeaseRequest struct {
+	Topic      string `json:"topic"`
+	TTL        string `json:"ttl"`
+	Partitions int    `json:"partitions,omitempty"`
+}
+
+// ExtendRequest extends a lease by TTL.
+type ExtendRequest struct {
+	TTL string `json:"ttl"`
+}
+
+// LeaseResponse is a lease and the results of the requests made to start it.
+type LeaseResponse struct {
+	Lease   Lease          `json:"lease"`
+	Results []ActionResult `json:"results"`
+}
+
+func parseTTL(ttl string) (time.Duration, error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q, expected a positive duration such as 336h", ttl)
+	}
+	return d, nil
+}
+
+// listLeases returns the leases of a route.
+func (rc *routeClient) listLeases(statePath string) ([]Lease, error) {
+	path := statePath + leasePath
+	topics, err := rc.zk.Children(path)
+	switch {
+	case err == gozk.ErrNoNode:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to read %v: %v", path, err)
+	}
+	sort.Strings(topics)
+	var leases []Lease
+	for _, topic := range topics {
+		data, err := rc.zk.Get(path + `/` + topic)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read lease %v: %v", topic, err)
+		}
+		var l Lease
+		if err := json.Unmarshal(data, &l); err != nil {
+			logger.Warn("Unable to parse lease", zap.String("Cluster", rc.name), zap.String("Topic", topic), zap.Error(err))
+			continue
+		}
+		leases = append(leases, l)
+	}
+	return leases, nil
+}
+
+func (rc *routeClient) saveLease(statePath string, l Lease) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	path := statePath + leasePath + `/` + l.Topic
+	_, err = rc.zk.Create(path, data, "", true)
+	if err == gozk.ErrNodeExists {
+		_, err = rc.zk.Set(path, data)
+	}
+	return err
+}
+
+func (rc *routeClient) deleteLease(statePath, topic string) error {
+	err := rc.zk.Delete(statePath + leasePath + `/` + topic)
+	if err == gozk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// readLeases splits the leases of a route into those still running or whose topic is still
+// replicated, and the expired leases of topics no longer replicated. Nothing is changed.
+func (rc *routeClient) readLeases(statePath string, snap Snapshot) (active, ended []Lease, err error) {
+	leases, err := rc.listLeases(statePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	replicated := newTopicSet(snap.replicated()...)
+	for _, l := range leases {
+		if l.Expires.After(snap.Taken) || replicated.has(l.Topic) {
+			active = append(active, l)
+			continue
+		}
+		ended = append(ended, l)
+	}
+	return active, ended, nil
+}
+
+// pruneLeases deletes ended leases.
+func (rc *routeClient) pruneLeases(statePath string, ended []Lease) {
+	for _, l := range ended {
+		if err := rc.deleteLease(statePath, l.Topic); err != nil {
+			logger.Warn("Unable to delete ended lease", zap.String("Cluster", rc.name), zap.String("Topic", l.Topic), zap.Error(err))
+		}
+	}
+}
+
+// notifyLeases announces once the leases that expire within notice.
+func (rc *routeClient) notifyLeases(statePath string, leases []Lease, notice time.Duration, now time.Time) {
+	for _, l := range leases {
+		if l.Notified || !l.Expires.After(now) || l.Expires.Sub(now) > notice {
+			continue
+		}
+		logger.Warn("Replication lease expiring", zap.String("Cluster", rc.name), zap.String("Topic", l.Topic), zap.Time("Expires", l.Expires))
+		publishEvent(eventLeaseExpiring, rc.name, l.Topic, "Replication lease expiring", map[string]interface{}{`expires`: l.Expires, `createdBy`: l.CreatedBy})
+		l.Notified = true
+		if err := rc.saveLease(statePath, l); err != nil {
+			logger.Warn("Unable to save lease", zap.String("Cluster", rc.name), zap.String("Topic", l.Topic), zap.Error(err))
+		}
+	}
+}
+
+// endLease records a topic blacklisted when its lease expired as owned by the lease and deletes
+// the lease.
+func (rc *routeClient) endLease(statePath string, res ActionResult) {
+	if !res.succeeded() {
+		return
+	}
+	if err := rc.recordExpired(statePath, res.Topic, ownerLease); err != nil {
+		logger.Warn("Unable to record expired lease blacklist ownership", zap.String("Cluster", rc.name), zap.String("Topic", res.Topic), zap.Error(err))
+	}
+	if err := rc.deleteLease(statePath, res.Topic); err != nil {
+		logger.Warn("Unable to delete expired lease", zap.String("Cluster", rc.name), zap.String("Topic", res.Topic), zap.Error(err))
+	}
+	publishEvent(eventLeaseExpired, rc.name, res.Topic, "Replication lease expired, topic blacklisted", nil)
+}
+
+// filterExpiredLeases adds blacklist actions for the replicated topics whose lease expired to
+// planned, marking a blacklist already planned for one as ending its lease.
+func filterExpiredLeases(snap Snapshot, planned []PlanAction) []PlanAction {
+	expired := make(topicSet)
+	for _, l := range snap.Leases {
+		if !l.Expires.After(snap.Taken) {
+			expired[l.Topic] = struct{}{}
+		}
+	}
+	blacklisted := make(topicSet)
+	for i, a := range planned {
+		if a.Action == blacklistAction && expired.has(a.Topic) {
+			planned[i].Lease = true
+			blacklisted[a.Topic] = struct{}{}
+		}
+	}
+	replicated := newTopicSet(snap.replicated()...)
+	for _, l := range snap.Leases {
+		if !expired.has(l.Topic) || !replicated.has(l.Topic) || blacklisted.has(l.Topic) {
+			continue
+		}
+		planned = append(planned, PlanAction{
+			Action:     blacklistAction,
+			Topic:      l.Topic,
+			Partitions: snap.ReplPartitions[l.Topic],
+			Reason:     fmt.Sprintf(reasonLeaseExpired, l.Expires.Format(time.RFC3339)),
+			Lease:      true,
+		})
+	}
+	return planned
+}
+
+// startLease whitelists a topic on a route with addTopic and records a lease for it. The
+// whitelist is recorded in the history so it can be rolled back. A route that does not execute
+// or is outside its maintenance windows refuses the lease.
+func startLease(C Cluster, route string, req LeaseRequest, identity string) (LeaseResponse, error) {
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		return LeaseResponse{}, err
+	}
+	if err := C.checkExecute(route, time.Now()); err != nil {
+		return LeaseResponse{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), C.Timeout)
+	defer cancel()
+	rc := newRouteClient(route)
+	defer rc.close()
+	defer rc.closeOnDone(ctx)()
+	if err := rc.connect(C); err != nil {
+		return LeaseResponse{}, err
+	}
+	snap, err := rc.gatherSnapshot(C.ZKRoot)
+	if err != nil {
+		return LeaseResponse{}, err
+	}
+	if newTopicSet(snap.replicated()...).has(req.Topic) {
+		return LeaseResponse{}, fmt.Errorf("topic %v is already replicated on route %v, extend its lease instead", req.Topic, route)
+	}
+	start := time.Now()
+	results, err := rc.addTopic(ctx, C, snap, req.Topic, req.Partitions)
+	if len(results) > 0 {
+		recordOperation(outcomeLease, route, start, results)
+	}
+	if err != nil {
+		return LeaseResponse{Results: results}, err
+	}
+	l := Lease{Route: route, Topic: req.Topic, Created: start, CreatedBy: identity, Expires: start.Add(ttl)}
+	if err := rc.saveLease(C.StatePath, l); err != nil {
+		return LeaseResponse{Lease: l, Results: results}, fmt.Errorf("topic %v whitelisted but the lease was not saved: %v", req.Topic, err)
+	}
+	logger.Info("Replication lease started", zap.String("Cluster", route), zap.String("Topic", l.Topic), zap.Time("Expires", l.Expires), zap.String("Identity", identity))
+	return LeaseResponse{Lease: l, Results: results}, nil
+}
+
+// extendLease extends the lease of a topic on a route by ttl and announces its expiry again.
+func extendLease(C Cluster, route, topic, ttl, identity string) (Lease, error) {
+	d, err := parseTTL(ttl)
+	if err != nil {
+		return Lease{}, err
+	}
+	rc := newRouteClient(route)
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return Lease{}, err
+	}
+	leases, err := rc.listLeases(C.StatePath)
+	if err != nil {
+		return Lease{}, err
+	}
+	for _, l := range leases {
+		if l.Topic != topic {
+			continue
+		}
+		from := l.Expires
+		if now := time.Now(); from.Before(now) {
+			from = now
+		}
+		l.Expires = from.Add(d)
+		l.Extended++
+		l.Notified = false
+		if err := rc.saveLease(C.StatePath, l); err != nil {
+			return Lease{}, err
+		}
+		logger.Info("Replication lease extended", zap.String("Cluster", route), zap.String("Topic", topic), zap.Time("Expires", l.Expires), zap.String("Identity", identity))
+		return l, nil
+	}
+	return Lease{}, fmt.Errorf("no lease for topic %v on route %v", topic, route)
+}
+
+// routeLeases returns the leases of every route, or only the given one.
+func routeLeases(config *Config, route string) ([]Lease, error) {
+	leases := []Lease{}
+	for name, C := range config.Clusters {
+		if route != "" && route != name {
+			continue
+		}
+		rc := newRouteClient(name)
+		if err := rc.launchZKClient(C.ZKAddress); err != nil {
+			return nil, fmt.Errorf("route %v: %v", name, err)
+		}
+		l, err := rc.listLeases(C.StatePath)
+		if err != nil {
+			return nil, fmt.Errorf("route %v: %v", name, err)
+		}
+		leases = append(leases, l...)
+	}
+	sort.SliceStable(leases, func(i, j int) bool { return leases[i].Expires.Before(leases[j].Expires) })
+	return leases, nil
+}
@@ -10,6 +10,8 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+var logOutput = os.Stdout
+
 var logFilter = logutils.LevelFilter{
 	Levels:   []logutils.LogLevel{"DEBUG", "INFO", "WARN", "ERROR"},
 	MinLevel: logutils.LogLevel("DEBUG"),
@@ -44,7 +46,7 @@ func configureLogger(logLevel string) *zap.Logger {
 		fmt.Printf("Invalid log level supplied. Defaulting to info: %s", logLevel)
 		level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
-	syncOutput = zapcore.Lock(os.Stdout)
+	syncOutput = zapcore.Lock(logOutput)
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = "timestamp"
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -4,13 +4,11 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
-	"net/http"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/hashicorp/serf/serf"
+	"github.com/jbvmio/serfcluster/client"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -36,7 +34,20 @@ var (
 	advertiseAddr string
 	advertisePort int
 	peerList      []string
-	amLeader      bool
+	planOnly      bool
+	planRoute     string
+	listHeld      bool
+	approvePlan   string
+	listLeases    bool
+	leaseTopic    string
+	extendTopic   string
+	leaseTTL      string
+	listMigration bool
+	migrateTopic  string
+	migrateFrom   string
+	migrateTo     string
+	abortMigrate  string
+	revertMigrate bool
 
 	logger              *zap.Logger
 	pf                  *pflag.FlagSet
@@ -46,25 +57,99 @@ var (
 func init() {
 	pf = pflag.NewFlagSet(defaultAppName, pflag.ExitOnError)
 	pf.StringVar(&cfg, "config", "./config.yaml", "Config location")
+	pf.BoolVar(&planOnly, "plan", false, "Print the reconcile plan of every route and exit, optionally limited to topic patterns given as arguments")
+	pf.StringVar(&planRoute, "route", "", "Limit --plan and --leases to a single route, or the route to --approve, --lease or --extend")
+	pf.BoolVar(&listHeld, "held", false, "Print the plans the leader holds for approval and exit")
+	pf.StringVar(&approvePlan, "approve", "", "Approve the plan with this ID held for --route and exit, optionally limited to topics given as arguments")
+	pf.BoolVar(&listLeases, "leases", false, "Print the replication leases and exit")
+	pf.StringVar(&leaseTopic, "lease", "", "Whitelist this topic on --route for --ttl and exit")
+	pf.StringVar(&extendTopic, "extend", "", "Extend the lease of this topic on --route by --ttl and exit")
+	pf.StringVar(&leaseTTL, "ttl", "", "How long to --lease a topic or --extend its lease, such as 336h")
+	pf.BoolVar(&listMigration, "migrations", false, "Print the topic migrations and exit")
+	pf.StringVar(&migrateTopic, "migrate", "", "Move the replication of this topic from route --from to route --to and exit")
+	pf.StringVar(&migrateFrom, "from", "", "The route to --migrate a topic from")
+	pf.StringVar(&migrateTo, "to", "", "The route to --migrate a topic to")
+	pf.StringVar(&abortMigrate, "abort", "", "Abort the migration with this ID and exit")
+	pf.BoolVar(&revertMigrate, "revert", false, "Blacklist the topic on the new route again when aborting a migration")
 }
 
 func main() {
 	pf.Parse(os.Args[1:])
 	config := GetConfig(cfg)
+	if planOnly || listHeld || approvePlan != "" || listLeases || leaseTopic != "" || extendTopic != "" || listMigration || migrateTopic != "" || abortMigrate != "" {
+		logOutput = os.Stderr
+	}
 	logger = configureLogger(config.LogLevel)
 	defer logger.Sync()
 
+	if planOnly {
+		if err := runPlanCommand(config, planRoute, pf.Args()...); err != nil {
+			logger.Fatal("Error Planning", zap.Error(err))
+		}
+		return
+	}
+	if listHeld {
+		if err := runHeldCommand(config); err != nil {
+			logger.Fatal("Error Listing Held Plans", zap.Error(err))
+		}
+		return
+	}
+	if approvePlan != "" {
+		if err := runApproveCommand(config, planRoute, approvePlan, pf.Args()...); err != nil {
+			logger.Fatal("Error Approving Plan", zap.Error(err))
+		}
+		return
+	}
+	if listLeases || leaseTopic != "" || extendTopic != "" {
+		if err := runLeaseCommand(config, planRoute, leaseTopic, extendTopic, leaseTTL); err != nil {
+			logger.Fatal("Error Managing Leases", zap.Error(err))
+		}
+		return
+	}
+	if listMigration || migrateTopic != "" || abortMigrate != "" {
+		if err := runMigrateCommand(config, migrateTopic, migrateFrom, migrateTo, abortMigrate, revertMigrate); err != nil {
+			logger.Fatal("Error Managing Migrations", zap.Error(err))
+		}
+		return
+	}
+
 	advertisePort = config.Monitor.BindPort
 	bindAddr = config.Monitor.BindAddress
 	bindPort = config.Monitor.BindPort
 	apiPort = config.Monitor.APIPort
 	peerList = config.Monitor.Peers
 
-	if config.Monitor.Whitelist {
-		performAction = bothAction
-	}
-
 	apiAddr = bindAddr + `:` + apiPort
+	history, err := openHistory(config.Monitor.DataDir, config.Monitor.HistoryRetention)
+	if err != nil {
+		logger.Fatal("Error Opening History", zap.Error(err))
+	}
+	runHistory = history
+	if config.Monitor.Auth.Enabled {
+		var err error
+		apiTokens, err = loadTokens(config.Monitor.Auth.TokenFile)
+		if err != nil {
+			logger.Fatal("Error Loading API Tokens", zap.Error(err))
+		}
+		if len(apiTokens) < 1 {
+			logger.Fatal("API authentication enabled but no tokens configured")
+		}
+		if !config.Monitor.TLS.Enabled && config.Monitor.Auth.PeerToken == "" {
+			logger.Fatal("API authentication enabled without TLS requires monitor.auth.peertoken")
+		}
+		peerToken = config.Monitor.Auth.PeerToken
+		if peerToken != "" {
+			apiTokens = append(apiTokens, apiToken{Name: `peer`, Role: rolePeer, secret: peerToken})
+		}
+	}
+	if config.Monitor.TLS.Enabled {
+		var err error
+		apiTLS, err = newTLSReloader(config.Monitor.TLS)
+		if err != nil {
+			logger.Fatal("Error Loading TLS Configuration", zap.Error(err))
+		}
+		go apiTLS.watch(config.Monitor.TLS.Reload)
+	}
 	cluster, err := setupCluster(bindAddr, advertiseAddr, bindPort, advertisePort, peerList...)
 	if err != nil {
 		logger.Fatal("Error Building Cluster", zap.Error(err))
@@ -72,7 +157,7 @@ func main() {
 	defer cluster.Leave()
 
 	theOneAndOnlyNumber = InitTheNumber(-1)
-	launchHTTPAPI(theOneAndOnlyNumber)
+	launchHTTPAPI(config, cluster, theOneAndOnlyNumber)
 
 	ctx := context.Background()
 	if name, err := os.Hostname(); err == nil {
@@ -82,7 +167,7 @@ func main() {
 	debugDataPrinterTicker := time.Tick(time.Second * 5)
 	numberBroadcastTicker := time.Tick(config.Monitor.PeerCheck)
 	leaderBroadcastTicker := time.Tick(config.Monitor.LeaderCheck)
-	leaderWorkTicker := time.Tick(config.Monitor.Reconcile)
+	leaderWorkTicker := time.Tick(scheduleTick(config))
 	for {
 		select {
 		case <-debugDataPrinterTicker:
@@ -101,12 +186,23 @@ func main() {
 		case <-leaderBroadcastTicker:
 			leaderCheck(cluster)
 		case <-leaderWorkTicker:
-			logger.Info("Check topics for any reconciliation", zap.Bool("Leader", amLeader))
-			if amLeader {
-				logger.Info("Perform reconciliation, I am the leader", zap.Bool("Leader", amLeader))
-				leaderWork(config, cluster)
-			} else {
-				logger.Info("Skipping reconciliation, I am not the leader", zap.Bool("Leader", amLeader))
+			logger.Info("Check topics for any reconciliation", zap.Bool("Leader", amLeader()))
+			if amLeader() {
+				resumeMigrations(config)
+			}
+			switch {
+			case isPaused():
+				logger.Info("Skipping reconciliation, reconciliation is paused", zap.Bool("Leader", amLeader()))
+			case amLeader():
+				logger.Info("Perform reconciliation, I am the leader", zap.Bool("Leader", amLeader()))
+				leaderWork(config, cluster, reconcileRequest{Scheduled: true})
+			default:
+				logger.Info("Skipping reconciliation, I am not the leader", zap.Bool("Leader", amLeader()))
+			}
+		case req := <-reconcileNow:
+			logger.Info("Perform requested reconciliation", zap.String("Identity", req.Identity), zap.String("Route", req.Route), zap.Bool("DryRun", req.DryRun), zap.Bool("Leader", amLeader()))
+			if amLeader() {
+				leaderWork(config, cluster, req)
 			}
 		}
 	}
@@ -169,15 +265,10 @@ func notifyMember(ctx context.Context, addr, port, recipient string, db *OneAndO
 	notifier := fmt.Sprintf("%s", ctx.Value(notifierKey))
 	logger.Debug("Notifying Member", zap.String("Notifier", notifier), zap.String("Recipient", recipient))
 	val, gen, _ := db.getValue()
-	URL := fmt.Sprintf("http://%v:%v/notify/%v/%v?notifier=%v", addr, port, val, gen, notifier)
-	req, err := http.NewRequest("POST", URL, nil)
+	c := client.New(fmt.Sprintf("%v://%v:%v", apiScheme(), addr, port), client.WithHTTPClient(peerClient()), client.WithToken(peerToken))
+	err := c.Notify(ctx, val, gen, notifier)
 	if err != nil {
-		return fmt.Errorf("unable to create POST request: %v", err)
-	}
-	req = req.WithContext(ctx)
-	_, err = http.DefaultClient.Do(req)
-	if err != nil {
-		err = fmt.Errorf("unable to complete request: %v", err)
+		logger.Debug("Member notification failed", zap.String("Recipient", recipient), zap.Error(err))
 	} else {
 		logger.Debug("Member notification successful")
 	}
@@ -198,55 +289,6 @@ timerLoop:
 	}
 }
 
-func launchHTTPAPI(db *OneAndOnlyNumber) {
-	go func() {
-		m := mux.NewRouter()
-		m.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
-			val, _, _ := db.getValue()
-			fmt.Fprintf(w, "%v", val)
-		})
-
-		m.HandleFunc("/set/{newVal}/{metadata}", func(w http.ResponseWriter, r *http.Request) {
-			vars := mux.Vars(r)
-			newVal, err := strconv.Atoi(vars["newVal"])
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "%v", err)
-				return
-			}
-			db.setValue(newVal, vars["metadata"])
-			fmt.Fprintf(w, "%v", newVal)
-		})
-
-		m.HandleFunc("/notify/{curVal}/{curGeneration}", func(w http.ResponseWriter, r *http.Request) {
-			vars := mux.Vars(r)
-			curVal, err := strconv.Atoi(vars["curVal"])
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "%v", err)
-				return
-			}
-			curGeneration, err := strconv.Atoi(vars["curGeneration"])
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "%v", err)
-				return
-			}
-
-			notifier := r.URL.Query().Get("notifier")
-			if changed := db.notifyValue(curVal, curGeneration, notifier); changed {
-				logger.Info("New Value Notification", zap.Int("NewValue", curVal), zap.Int("Generation", curGeneration), zap.String("Notifier", notifier))
-				w.WriteHeader(http.StatusOK)
-			}
-		})
-		logger.Info(`Started API`, zap.String("address", apiAddr))
-		err := http.ListenAndServe(apiAddr, m)
-		if err != nil {
-			logger.Fatal("API Failure", zap.Error(err))
-		}
-	}()
-}
-
 func setupCluster(bindAddr, advertiseAddr string, bindPort, advertisePort int, peers ...string) (*serf.Serf, error) {
 	conf := serf.DefaultConfig()
 	conf.Init()
@@ -257,6 +299,9 @@ func setupCluster(bindAddr, advertiseAddr string, bindPort, advertisePort int, p
 	conf.MemberlistConfig.AdvertisePort = advertisePort
 	conf.MemberlistConfig.Logger = zap.NewStdLog(logger)
 	conf.MemberlistConfig.Logger.SetOutput(&logFilter)
+	eventCh := make(chan serf.Event, eventBufferSize)
+	conf.EventCh = eventCh
+	go watchSerfEvents(eventCh)
 
 	cluster, err := serf.Create(conf)
 	if err != nil {
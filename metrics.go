@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serveMetrics writes route and drift gauges in the Prometheus text format.
+func serveMetrics(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `text/plain; version=0.0.4`)
+		writeGauge(w, `skrr_leader`, `Whether this node is the leader.`, boolGauge(amLeader()))
+		writeGauge(w, `skrr_paused`, `Whether scheduled reconciliation is paused.`, boolGauge(isPaused()))
+
+		statuses := routeStatuses.list(config)
+		writeHelp(w, `skrr_route_last_run_timestamp_seconds`, `Time of the last reconcile of a route.`)
+		for _, s := range statuses {
+			if !s.LastRun.IsZero() {
+				writeSample(w, `skrr_route_last_run_timestamp_seconds`, float64(s.LastRun.Unix()), `route`, s.Name)
+			}
+		}
+		writeHelp(w, `skrr_route_last_run_duration_seconds`, `Duration of the last reconcile of a route.`)
+		for _, s := range statuses {
+			if d, err := time.ParseDuration(s.Duration); err == nil {
+				writeSample(w, `skrr_route_last_run_duration_seconds`, d.Seconds(), `route`, s.Name)
+			}
+		}
+		writeHelp(w, `skrr_route_outcome`, `Outcome of the last reconcile of a route.`)
+		for _, s := range statuses {
+			if s.Outcome != "" {
+				writeSample(w, `skrr_route_outcome`, 1, `route`, s.Name, `outcome`, s.Outcome)
+			}
+		}
+		writeHelp(w, `skrr_route_planned_actions`, `Actions in the latest plan of a route.`)
+		for _, s := range statuses {
+			if s.Plan == nil {
+				continue
+			}
+			counts := make(map[string]int)
+			for _, a := range s.Plan.Actions {
+				counts[a.Action.String()]++
+			}
+			for _, action := range sortedKeys(counts) {
+				writeSample(w, `skrr_route_planned_actions`, float64(counts[action]), `route`, s.Name, `action`, action)
+			}
+		}
+		writeHelp(w, `skrr_route_deferred_actions`, `Actions held for confirmation in the latest plan of a route.`)
+		writeHelp(w, `skrr_route_partition_drift_topics`, `Replicated topics whose partition counts differ.`)
+		writeHelp(w, `skrr_route_config_drift`, `Topic configs whose destination value differs from the source.`)
+		for _, s := range statuses {
+			if s.Plan == nil {
+				continue
+			}
+			writeSample(w, `skrr_route_deferred_actions`, float64(len(s.Plan.Deferred)), `route`, s.Name)
+			writeSample(w, `skrr_route_partition_drift_topics`, float64(len(s.Plan.Drift)), `route`, s.Name)
+			for _, d := range s.Plan.Configs {
+				writeSample(w, `skrr_route_config_drift`, 1, `route`, s.Name, `topic`, d.Topic, `config`, d.Config)
+			}
+		}
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value float64) {
+	writeHelp(w, name, help)
+	writeSample(w, name, value)
+}
+
+func writeHelp(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// writeSample writes one sample, labels given as name and value pairs.
+func writeSample(w io.Writer, name string, value float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	if len(pairs) > 0 {
+		name += `{` + strings.Join(pairs, `,`) + `}`
+	}
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
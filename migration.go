@@ -0,0 +1,893 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	gozk "github.com/samuel/go-zookeeper/zk"
+	"go.uber.org/zap"
+)
+
+const (
+	outcomeMigration = `migration`
+	// migrationPoll is how often a migration checks the new route while confirming replication.
+	migrationPoll = time.Second * 15
+	// migrationHistorySize bounds how many finished migrations are kept.
+	migrationHistorySize = 100
+
+	stepAdd       = `add`
+	stepConfirm   = `confirm`
+	stepBlacklist = `blacklist`
+	stepRevert    = `revert`
+
+	migrationPending   = `pending`
+	migrationRunning   = `running`
+	migrationSucceeded = `succeeded`
+	migrationFailed    = `failed`
+	migrationAborted   = `aborted`
+	migrationSkipped   = `skipped`
+
+	// migrationPath holds a node per migration, under the state path of its new route.
+	migrationPath = `/migrations`
+)
+
+var (
+	errMigrationAborted   = errors.New(`migration aborted`)
+	errMigrationHandedOff = errors.New(`no longer the leader`)
+)
+
+// MigrationRequest moves the replication of Topic from route From to route To. Partitions
+// default to the source partition count of the new route. Timeout is how long to wait for the
+// new route to replicate, monitor.migrationtimeout when empty.
+type MigrationRequest struct {
+	Topic      string `json:"topic"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Partitions int    `json:"partitions,omitempty"`
+	Timeout    string `json:"timeout,omitempty"`
+}
+
+// AbortRequest stops a migration before it blacklists the topic on the old route. Revert
+// blacklists the topic on the new route again when the migration whitelisted it.
+type AbortRequest struct {
+	Revert bool `json:"revert"`
+}
+
+// Migration is a job moving the replication of a topic between routes. The topic is added to
+// the new route, confirmed replicating there, then blacklisted on the old route. Each step
+// checks the routes first and the job stops at the first failed check. Migrations are saved
+// under the state path of the new route and run by the leader.
+type Migration struct {
+	ID         string          `json:"id"`
+	Topic      string          `json:"topic"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Partitions int             `json:"partitions,omitempty"`
+	State      string          `json:"state"`
+	Created    time.Time       `json:"created"`
+	CreatedBy  string          `json:"createdBy"`
+	Updated    time.Time       `json:"updated"`
+	Timeout    string          `json:"timeout"`
+	Steps      []MigrationStep `json:"steps"`
+	Error      string          `json:"error,omitempty"`
+	AbortedBy  string          `json:"abortedBy,omitempty"`
+	Revert     bool            `json:"revert,omitempty"`
+	// Whitelisted is saved before the migration asks the new route to whitelist the topic, so
+	// a revert after a failover knows to blacklist it again.
+	Whitelisted bool `json:"whitelisted,omitempty"`
+}
+
+// MigrationStep is a step of a Migration, the outcome of its check and the requests it made.
+type MigrationStep struct {
+	Name     string         `json:"name"`
+	State    string         `json:"state"`
+	Check    string         `json:"check,omitempty"`
+	Started  time.Time      `json:"started,omitempty"`
+	Finished time.Time      `json:"finished,omitempty"`
+	Results  []ActionResult `json:"results,omitempty"`
+}
+
+func (m *Migration) active() bool {
+	return m.State == migrationPending || m.State == migrationRunning
+}
+
+func (m *Migration) step(name string) *MigrationStep {
+	for i := range m.Steps {
+		if m.Steps[i].Name == name {
+			return &m.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (m *Migration) copy() Migration {
+	c := *m
+	c.Steps = append([]MigrationStep(nil), m.Steps...)
+	return c
+}
+
+// abortable reports why a migration can no longer be aborted. One that began blacklisting the
+// topic on the old route is past its last check.
+func (m *Migration) abortable() error {
+	switch {
+	case !m.active():
+		return fmt.Errorf("migration %v already %v", m.ID, m.State)
+	case m.AbortedBy != "":
+		return fmt.Errorf("migration %v is already aborting", m.ID)
+	case m.step(stepBlacklist).State != migrationPending:
+		return fmt.Errorf("migration %v is already blacklisting topic %v on route %v", m.ID, m.Topic, m.From)
+	}
+	return nil
+}
+
+// migrationStore holds the migrations this node runs. Every change is saved to ZooKeeper by
+// the run, which is where migrations are listed from and resumed by a new leader.
+type migrationStore struct {
+	jobs   map[string]*Migration
+	aborts map[string]chan struct{}
+	mu     sync.RWMutex
+}
+
+var migrations = &migrationStore{
+	jobs:   make(map[string]*Migration),
+	aborts: make(map[string]chan struct{}),
+}
+
+// add runs a migration on this node. The abort channel is closed at once for a migration
+// already aborted.
+func (s *migrationStore) add(m Migration) (<-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[m.ID]; ok {
+		return nil, false
+	}
+	abort := make(chan struct{})
+	if m.AbortedBy != "" {
+		close(abort)
+	}
+	s.jobs[m.ID] = &m
+	s.aborts[m.ID] = abort
+	return abort, true
+}
+
+func (s *migrationStore) get(id string) (Migration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.jobs[id]
+	if !ok {
+		return Migration{}, false
+	}
+	return m.copy(), true
+}
+
+// begin starts a step of a migration, unless an abort was requested.
+func (s *migrationStore) begin(id, name string) (Migration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.jobs[id]
+	if m.AbortedBy != "" {
+		return m.copy(), false
+	}
+	now := time.Now()
+	m.State = migrationRunning
+	m.Updated = now
+	if step := m.step(name); step != nil {
+		step.State = migrationRunning
+		step.Started = now
+	}
+	return m.copy(), true
+}
+
+// check updates the outcome of the check of a running step.
+func (s *migrationStore) check(id, name, check string) Migration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.jobs[id]
+	m.Updated = time.Now()
+	if step := m.step(name); step != nil {
+		step.Check = check
+	}
+	return m.copy()
+}
+
+// whitelisting records that the migration is whitelisting the topic on the new route.
+func (s *migrationStore) whitelisting(id string) Migration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.jobs[id]
+	m.Whitelisted = true
+	m.Updated = time.Now()
+	return m.copy()
+}
+
+// end finishes a step of a migration, adding it when the migration has no such step.
+func (s *migrationStore) end(id, name, state, check string, results []ActionResult) Migration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.jobs[id]
+	now := time.Now()
+	m.Updated = now
+	step := m.step(name)
+	if step == nil {
+		m.Steps = append(m.Steps, MigrationStep{Name: name, Started: now})
+		step = &m.Steps[len(m.Steps)-1]
+	}
+	step.State, step.Check, step.Results, step.Finished = state, check, results, now
+	return m.copy()
+}
+
+// finish ends a migration, skipping the steps it did not start, and stops running it.
+func (s *migrationStore) finish(id, state, errMsg string) Migration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.jobs[id]
+	m.State = state
+	m.Error = errMsg
+	m.Updated = time.Now()
+	for i := range m.Steps {
+		if m.Steps[i].State == migrationPending {
+			m.Steps[i].State = migrationSkipped
+		}
+	}
+	delete(s.jobs, id)
+	delete(s.aborts, id)
+	return m.copy()
+}
+
+// release stops running a migration without finishing it, so the next leader resumes it.
+func (s *migrationStore) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	delete(s.aborts, id)
+}
+
+// abort asks a migration running on this node to stop before its next step.
+func (s *migrationStore) abort(id, identity string, revert bool) (Migration, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.jobs[id]
+	if !ok {
+		return Migration{}, false, nil
+	}
+	if err := m.abortable(); err != nil {
+		return Migration{}, true, err
+	}
+	m.AbortedBy = identity
+	m.Revert = revert
+	m.Updated = time.Now()
+	close(s.aborts[id])
+	return m.copy(), true, nil
+}
+
+// saveMigration writes a migration under the state path of its new route.
+func saveMigration(C Cluster, m Migration) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	rc := newRouteClient(m.To)
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return err
+	}
+	path := C.StatePath + migrationPath + `/` + m.ID
+	_, err = rc.zk.Create(path, data, "", true)
+	if err == gozk.ErrNodeExists {
+		_, err = rc.zk.Set(path, data)
+	}
+	return err
+}
+
+// routeMigrations returns the migrations saved under the state path of a route, oldest first.
+func routeMigrations(C Cluster, route string) ([]Migration, error) {
+	rc := newRouteClient(route)
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return nil, err
+	}
+	path := C.StatePath + migrationPath
+	ids, err := rc.zk.Children(path)
+	switch {
+	case err == gozk.ErrNoNode:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to read %v: %v", path, err)
+	}
+	var list []Migration
+	for _, id := range ids {
+		data, err := rc.zk.Get(path + `/` + id)
+		if err == gozk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration %v: %v", id, err)
+		}
+		var m Migration
+		if err := json.Unmarshal(data, &m); err != nil {
+			logger.Warn("Unable to parse migration", zap.String("Cluster", route), zap.String("Migration", id), zap.Error(err))
+			continue
+		}
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// listMigrations returns the migrations of every route, newest first.
+func listMigrations(config *Config) ([]Migration, error) {
+	list := []Migration{}
+	seen := make(map[string]bool)
+	for name, C := range config.Clusters {
+		routeList, err := routeMigrations(C, name)
+		if err != nil {
+			return nil, fmt.Errorf("route %v: %v", name, err)
+		}
+		for _, m := range routeList {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				list = append(list, m)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	return list, nil
+}
+
+func findMigration(config *Config, id string) (Migration, bool, error) {
+	list, err := listMigrations(config)
+	if err != nil {
+		return Migration{}, false, err
+	}
+	for _, m := range list {
+		if m.ID == id {
+			return m, true, nil
+		}
+	}
+	return Migration{}, false, nil
+}
+
+// pruneMigrations deletes the oldest finished migrations of a route beyond migrationHistorySize.
+func pruneMigrations(C Cluster, route string) {
+	list, err := routeMigrations(C, route)
+	if err != nil {
+		logger.Warn("Unable to prune migrations", zap.String("Cluster", route), zap.Error(err))
+		return
+	}
+	var finished []Migration
+	for _, m := range list {
+		if !m.active() {
+			finished = append(finished, m)
+		}
+	}
+	rc := newRouteClient(route)
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return
+	}
+	for i := 0; i < len(finished)-migrationHistorySize; i++ {
+		if err := rc.zk.Delete(C.StatePath + migrationPath + `/` + finished[i].ID); err != nil && err != gozk.ErrNoNode {
+			logger.Warn("Unable to prune migration", zap.String("Cluster", route), zap.String("Migration", finished[i].ID), zap.Error(err))
+		}
+	}
+}
+
+// startMigration checks a migration request against the old route, saves the migration and
+// starts running it on this node, which must be the leader. Both routes must execute and be in
+// a maintenance window, and every step changing a route checks it again.
+func startMigration(config *Config, req MigrationRequest, identity string) (Migration, error) {
+	from, ok := config.Clusters[req.From]
+	if !ok {
+		return Migration{}, fmt.Errorf("unknown route %v", req.From)
+	}
+	to, ok := config.Clusters[req.To]
+	if !ok {
+		return Migration{}, fmt.Errorf("unknown route %v", req.To)
+	}
+	timeout := config.Monitor.MigrationTimeout
+	if req.Timeout != "" {
+		var err error
+		if timeout, err = parseTTL(req.Timeout); err != nil {
+			return Migration{}, err
+		}
+	}
+	switch {
+	case req.Topic == "":
+		return Migration{}, fmt.Errorf("a topic is required")
+	case req.From == req.To:
+		return Migration{}, fmt.Errorf("topic %v cannot migrate to the route it is on", req.Topic)
+	case to.ConsumerGroup == "":
+		return Migration{}, fmt.Errorf("route %v has no consumergroup to confirm it replicates topic %v", req.To, req.Topic)
+	}
+	if err := checkProtected(from, req.From, req.Topic); err != nil {
+		return Migration{}, err
+	}
+	for _, r := range []struct {
+		name string
+		C    Cluster
+	}{{req.To, to}, {req.From, from}} {
+		if err := r.C.checkExecute(r.name, time.Now()); err != nil {
+			return Migration{}, err
+		}
+	}
+	existing, err := listMigrations(config)
+	if err != nil {
+		return Migration{}, err
+	}
+	for _, m := range existing {
+		if m.Topic == req.Topic && m.active() {
+			return Migration{}, fmt.Errorf("migration %v is already moving topic %v", m.ID, m.Topic)
+		}
+	}
+	rc := newRouteClient(req.From)
+	if err := rc.launchZKClient(from.ZKAddress); err != nil {
+		return Migration{}, err
+	}
+	if err := rc.getZKTarget(from.ZKRoot, req.From); err != nil {
+		return Migration{}, err
+	}
+	snap := Snapshot{ZKTopics: rc.getZKTopics(from.ZKRoot), Blacklist: rc.getZKBlacklist(from.ZKRoot)}
+	if !newTopicSet(snap.replicated()...).has(req.Topic) {
+		return Migration{}, fmt.Errorf("topic %v is not replicated on route %v", req.Topic, req.From)
+	}
+	now := time.Now()
+	m := Migration{
+		ID:         fmt.Sprintf("%s-%s-%d", outcomeMigration, req.Topic, now.UnixNano()),
+		Topic:      req.Topic,
+		From:       req.From,
+		To:         req.To,
+		Partitions: req.Partitions,
+		State:      migrationPending,
+		Created:    now,
+		CreatedBy:  identity,
+		Updated:    now,
+		Timeout:    timeout.String(),
+	}
+	for _, name := range []string{stepAdd, stepConfirm, stepBlacklist} {
+		m.Steps = append(m.Steps, MigrationStep{Name: name, State: migrationPending})
+	}
+	if err := saveMigration(to, m); err != nil {
+		return Migration{}, fmt.Errorf("unable to save migration: %v", err)
+	}
+	pruneMigrations(to, req.To)
+	logger.Info("Migration started", zap.String("Migration", m.ID), zap.String("Topic", req.Topic), zap.String("From", req.From), zap.String("To", req.To), zap.String("Identity", identity))
+	runMigration(config, m)
+	return m, nil
+}
+
+// abortMigration aborts a migration. One running on this node stops before its next step,
+// one saved as running elsewhere is marked so the leader resuming it aborts it instead.
+func abortMigration(config *Config, id, identity string, revert bool) (Migration, error) {
+	m, ok, err := migrations.abort(id, identity, revert)
+	if err != nil {
+		return Migration{}, err
+	}
+	if !ok {
+		var found bool
+		if m, found, err = findMigration(config, id); err != nil {
+			return Migration{}, err
+		}
+		if !found {
+			return Migration{}, fmt.Errorf("migration %v not found", id)
+		}
+		if err := m.abortable(); err != nil {
+			return Migration{}, err
+		}
+		m.AbortedBy, m.Revert, m.Updated = identity, revert, time.Now()
+	}
+	if err := saveMigration(config.Clusters[m.To], m); err != nil {
+		return Migration{}, fmt.Errorf("unable to save migration: %v", err)
+	}
+	return m, nil
+}
+
+// resumeMigrations runs the saved migrations still active that this node is not running, as
+// left by a previous leader. Every step checks the routes before acting, so a step interrupted
+// by a failover is run again; migrations of routes no longer configured are failed.
+func resumeMigrations(config *Config) {
+	list, err := listMigrations(config)
+	if err != nil {
+		logger.Warn("Unable to read migrations to resume", zap.Error(err))
+		return
+	}
+	resume, orphaned := resumable(config, list)
+	for _, m := range orphaned {
+		m.State, m.Error, m.Updated = migrationFailed, `route no longer configured`, time.Now()
+		if to, ok := config.Clusters[m.To]; ok {
+			if err := saveMigration(to, m); err != nil {
+				logger.Warn("Unable to save migration", zap.String("Migration", m.ID), zap.Error(err))
+			}
+		}
+		logger.Error("Migration failed, route no longer configured", zap.String("Migration", m.ID), zap.String("From", m.From), zap.String("To", m.To))
+	}
+	for _, m := range resume {
+		logger.Info("Resuming migration", zap.String("Migration", m.ID), zap.String("Topic", m.Topic), zap.String("State", m.State))
+		runMigration(config, m)
+	}
+}
+
+// resumable splits the saved migrations still active that this node is not running into those
+// to resume and those whose routes are no longer configured.
+func resumable(config *Config, list []Migration) (resume, orphaned []Migration) {
+	for _, m := range list {
+		if !m.active() {
+			continue
+		}
+		if _, ok := migrations.get(m.ID); ok {
+			continue
+		}
+		_, fromOK := config.Clusters[m.From]
+		_, toOK := config.Clusters[m.To]
+		if !fromOK || !toOK {
+			orphaned = append(orphaned, m)
+			continue
+		}
+		resume = append(resume, m)
+	}
+	return resume, orphaned
+}
+
+// runMigration runs a saved migration on this node in the background.
+func runMigration(config *Config, m Migration) {
+	abort, ok := migrations.add(m)
+	if !ok {
+		return
+	}
+	timeout, err := time.ParseDuration(m.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = config.Monitor.MigrationTimeout
+	}
+	run := &migrationRun{
+		id:      m.ID,
+		req:     MigrationRequest{Topic: m.Topic, From: m.From, To: m.To, Partitions: m.Partitions},
+		from:    config.Clusters[m.From],
+		to:      config.Clusters[m.To],
+		timeout: timeout,
+		abort:   abort,
+	}
+	go run.run()
+}
+
+// migrationRun executes the steps of a migration.
+type migrationRun struct {
+	id      string
+	req     MigrationRequest
+	from    Cluster
+	to      Cluster
+	timeout time.Duration
+	abort   <-chan struct{}
+}
+
+// save writes the state of the migration to ZooKeeper.
+func (r *migrationRun) save(m Migration) {
+	if err := saveMigration(r.to, m); err != nil {
+		logger.Warn("Unable to save migration", zap.String("Migration", r.id), zap.Error(err))
+	}
+}
+
+// run executes the steps not yet succeeded. It stops without finishing the migration when this
+// node is no longer the leader, leaving it to the next one.
+func (r *migrationRun) run() {
+	L := logger.With(zap.String("Migration", r.id), zap.String("Topic", r.req.Topic))
+	steps := []struct {
+		name string
+		run  func() (string, []ActionResult, error)
+	}{
+		{stepAdd, r.add},
+		{stepConfirm, r.confirm},
+		{stepBlacklist, r.blacklist},
+	}
+	for _, step := range steps {
+		if m, _ := migrations.get(r.id); m.step(step.name).State == migrationSucceeded {
+			continue
+		}
+		if !amLeader() {
+			r.handOff()
+			return
+		}
+		m, ok := migrations.begin(r.id, step.name)
+		if !ok {
+			r.aborted()
+			return
+		}
+		r.save(m)
+		check, results, err := step.run()
+		switch {
+		case err == errMigrationHandedOff:
+			r.handOff()
+			return
+		case err == errMigrationAborted:
+			r.save(migrations.end(r.id, step.name, migrationAborted, check, results))
+			r.aborted()
+			return
+		case err != nil:
+			migrations.end(r.id, step.name, migrationFailed, err.Error(), results)
+			r.save(migrations.finish(r.id, migrationFailed, fmt.Sprintf("%v: %v", step.name, err)))
+			L.Error("Migration failed", zap.String("Step", step.name), zap.Error(err))
+			publishError(r.req.To, r.req.Topic, fmt.Sprintf("Migration %v failed at step %v", r.id, step.name), err)
+			return
+		}
+		r.save(migrations.end(r.id, step.name, migrationSucceeded, check, results))
+		L.Info("Migration step done", zap.String("Step", step.name), zap.String("Check", check))
+		publishEvent(eventMigrationStep, r.req.To, r.req.Topic, fmt.Sprintf("Migration %v: %v", step.name, check), map[string]interface{}{`migration`: r.id})
+	}
+	r.save(migrations.finish(r.id, migrationSucceeded, ""))
+	L.Info("Migration succeeded", zap.String("From", r.req.From), zap.String("To", r.req.To))
+	publishEvent(eventMigrationFinish, r.req.To, r.req.Topic, fmt.Sprintf("Migrated from %v to %v", r.req.From, r.req.To), map[string]interface{}{`migration`: r.id, `state`: migrationSucceeded})
+}
+
+// handOff stops running the migration on a node that lost leadership.
+func (r *migrationRun) handOff() {
+	migrations.release(r.id)
+	logger.Warn("Migration left to the next leader", zap.String("Migration", r.id), zap.String("Topic", r.req.Topic))
+}
+
+// add whitelists the topic on the new route, unless it is already replicated there.
+func (r *migrationRun) add() (string, []ActionResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.to.Timeout)
+	defer cancel()
+	rc := newRouteClient(r.req.To)
+	defer rc.close()
+	defer rc.closeOnDone(ctx)()
+	if err := rc.connect(r.to); err != nil {
+		return "", nil, err
+	}
+	snap, err := rc.gatherSnapshot(r.to.ZKRoot)
+	if err != nil {
+		return "", nil, err
+	}
+	if newTopicSet(snap.replicated()...).has(r.req.Topic) {
+		return fmt.Sprintf("already replicated on route %v", r.req.To), nil, nil
+	}
+	if err := r.to.checkExecute(r.req.To, time.Now()); err != nil {
+		return "", nil, err
+	}
+	if err := saveMigration(r.to, migrations.whitelisting(r.id)); err != nil {
+		return "", nil, fmt.Errorf("unable to save migration: %v", err)
+	}
+	start := time.Now()
+	results, err := rc.addTopic(ctx, r.to, snap, r.req.Topic, r.req.Partitions)
+	if len(results) > 0 {
+		recordOperation(outcomeMigration, r.req.To, start, results)
+	}
+	if err != nil {
+		return "", results, err
+	}
+	return fmt.Sprintf("whitelisted on route %v", r.req.To), results, nil
+}
+
+// confirm waits until the new route replicates the topic, as reported by its uReplicator and
+// its consumer group on the source.
+func (r *migrationRun) confirm() (string, []ActionResult, error) {
+	rc := newRouteClient(r.req.To)
+	defer rc.close()
+	if err := rc.connect(r.to); err != nil {
+		return "", nil, err
+	}
+	base, err := rc.replicationState(r.to, r.req.Topic)
+	if err != nil {
+		return "", nil, err
+	}
+	deadline := time.Now().Add(r.timeout)
+	check := `waiting for the first check`
+	for {
+		select {
+		case <-r.abort:
+			return check, nil, errMigrationAborted
+		case <-time.After(migrationPoll):
+		}
+		state, err := rc.replicationState(r.to, r.req.Topic)
+		if err != nil {
+			check = err.Error()
+		} else {
+			var ok bool
+			if check, ok = state.confirms(base, r.to.ConsumerGroup); ok {
+				return check, nil, nil
+			}
+		}
+		r.save(migrations.check(r.id, stepConfirm, check))
+		if !amLeader() {
+			return check, nil, errMigrationHandedOff
+		}
+		if time.Now().After(deadline) {
+			return check, nil, fmt.Errorf("not confirmed replicating on route %v within %v: %v", r.req.To, r.timeout, check)
+		}
+	}
+}
+
+// checkProtected fails the migration of a topic its old route protects from being blacklisted.
+func checkProtected(from Cluster, route, topic string) error {
+	if p, ok := from.protect.match(topic); ok {
+		return fmt.Errorf("topic %v is protected on route %v by pattern %v", topic, route, p)
+	}
+	return nil
+}
+
+// blacklist blacklists the topic on the old route once the new route still replicates it. The
+// blacklist entry is recorded as owned by the migration, so the old route never whitelists the
+// topic again, even when it whitelists unowned entries. A topic the old route protects is not
+// blacklisted.
+func (r *migrationRun) blacklist() (string, []ActionResult, error) {
+	if err := checkProtected(r.from, r.req.From, r.req.Topic); err != nil {
+		return "", nil, err
+	}
+	to := newRouteClient(r.req.To)
+	if err := to.launchZKClient(r.to.ZKAddress); err != nil {
+		return "", nil, err
+	}
+	if err := to.getZKTarget(r.to.ZKRoot, r.req.To); err != nil {
+		return "", nil, err
+	}
+	snap := Snapshot{ZKTopics: to.getZKTopics(r.to.ZKRoot), Blacklist: to.getZKBlacklist(r.to.ZKRoot)}
+	if !newTopicSet(snap.replicated()...).has(r.req.Topic) {
+		return "", nil, fmt.Errorf("topic %v is no longer replicated on route %v", r.req.Topic, r.req.To)
+	}
+	from := newRouteClient(r.req.From)
+	if err := from.launchZKClient(r.from.ZKAddress); err != nil {
+		return "", nil, err
+	}
+	if err := from.getZKTarget(r.from.ZKRoot, r.req.From); err != nil {
+		return "", nil, err
+	}
+	snap = Snapshot{ZKTopics: from.getZKTopics(r.from.ZKRoot), Blacklist: from.getZKBlacklist(r.from.ZKRoot)}
+	if !newTopicSet(snap.replicated()...).has(r.req.Topic) {
+		// A previous leader may have blacklisted the topic without recording it.
+		if !newTopicSet(snap.Blacklist...).has(r.req.Topic) {
+			return fmt.Sprintf("no longer replicated on route %v", r.req.From), nil, nil
+		}
+		if err := r.recordBlacklisted(); err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("already blacklisted on route %v", r.req.From), nil, nil
+	}
+	if err := r.from.checkExecute(r.req.From, time.Now()); err != nil {
+		return "", nil, err
+	}
+	parts, err := from.zkListPartitions(r.from.ZKRoot+`/`+from.target, r.req.Topic)
+	if err != nil {
+		return "", nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.from.Timeout)
+	defer cancel()
+	start := time.Now()
+	res := deleteRequest(ctx, &http.Client{}, r.req.From, r.req.Topic, r.from.ReplAPI+apiTopicPath+`/`+r.req.Topic)
+	res.Partitions = parts[r.req.Topic]
+	res.setInverse(nil)
+	results := []ActionResult{res}
+	recordOperation(outcomeMigration, r.req.From, start, results)
+	if !res.succeeded() {
+		return "", results, fmt.Errorf("unable to blacklist topic %v on route %v: %v %v", r.req.Topic, r.req.From, res.StatusCode, res.Error)
+	}
+	if err := r.recordBlacklisted(); err != nil {
+		return "", results, err
+	}
+	return fmt.Sprintf("replicated on route %v, blacklisted on route %v", r.req.To, r.req.From), results, nil
+}
+
+// recordBlacklisted records the migration as the owner of the topic's entry on the old route's blacklist.
+func (r *migrationRun) recordBlacklisted() error {
+	if _, err := setBlacklistOwner(r.from, r.req.From, r.req.Topic, ownerMigration, r.id); err != nil {
+		return fmt.Errorf("topic %v blacklisted on route %v but not recorded as migrated: %v", r.req.Topic, r.req.From, err)
+	}
+	return nil
+}
+
+// aborted finishes an aborted migration, first blacklisting the topic on the new route again
+// when a revert was requested and the migration whitelisted it.
+func (r *migrationRun) aborted() {
+	m, _ := migrations.get(r.id)
+	if m.Revert {
+		check, results, err := r.revert(m)
+		state := migrationSucceeded
+		if err != nil {
+			state, check = migrationFailed, err.Error()
+		}
+		r.save(migrations.end(r.id, stepRevert, state, check, results))
+	}
+	m = migrations.finish(r.id, migrationAborted, "")
+	r.save(m)
+	logger.Warn("Migration aborted", zap.String("Migration", r.id), zap.String("Topic", r.req.Topic), zap.String("Identity", m.AbortedBy), zap.Bool("Revert", m.Revert))
+	publishEvent(eventMigrationFinish, r.req.To, r.req.Topic, fmt.Sprintf("Migration aborted by %v", m.AbortedBy), map[string]interface{}{`migration`: r.id, `state`: migrationAborted})
+}
+
+func (r *migrationRun) revert(m Migration) (string, []ActionResult, error) {
+	if !m.Whitelisted {
+		return fmt.Sprintf("not whitelisted on route %v by the migration", r.req.To), nil, nil
+	}
+	if err := r.to.checkExecute(r.req.To, time.Now()); err != nil {
+		return "", nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.to.Timeout)
+	defer cancel()
+	start := time.Now()
+	res := deleteRequest(ctx, &http.Client{}, r.req.To, r.req.Topic, r.to.ReplAPI+apiTopicPath+`/`+r.req.Topic)
+	res.setInverse(nil)
+	results := []ActionResult{res}
+	recordOperation(outcomeMigration, r.req.To, start, results)
+	if !res.succeeded() {
+		return "", results, fmt.Errorf("unable to blacklist topic %v on route %v: %v %v", r.req.Topic, r.req.To, res.StatusCode, res.Error)
+	}
+	return fmt.Sprintf("blacklisted on route %v", r.req.To), results, nil
+}
+
+// replicationState is what a route's own uReplicator reports about the replication of a
+// single topic. Destination offsets are not used, as other routes may write to the same
+// destination topic.
+type replicationState struct {
+	Registered    bool
+	Blacklisted   bool
+	Partitions    int
+	Online        int
+	SrcPartitions int
+	SrcOffset     int64
+	// Committed is the sum of the offsets the route's consumer group committed on the source.
+	Committed int64
+	// Uncommitted is how many partitions the consumer group has not committed an offset for.
+	Uncommitted int
+}
+
+// replicationState reads the uReplicator registration and worker assignment of a topic, and
+// the progress of the route's consumer group on the source.
+func (rc *routeClient) replicationState(C Cluster, topic string) (replicationState, error) {
+	base := C.ZKRoot + `/` + rc.target
+	s := replicationState{
+		Registered:  newTopicSet(rc.getZKTopics(C.ZKRoot)...).has(topic),
+		Blacklisted: newTopicSet(rc.getZKBlacklist(C.ZKRoot)...).has(topic),
+	}
+	parts, err := rc.zkListPartitions(base, topic)
+	if err != nil {
+		return s, err
+	}
+	s.Partitions = parts[topic]
+	if s.Online, err = rc.zkOnlinePartitions(base, topic); err != nil {
+		return s, err
+	}
+	srcMeta, err := rc.src.GetTopicMeta()
+	if err != nil {
+		return s, fmt.Errorf("unable to read source kafka cluster: %v", err)
+	}
+	_, srcParts := topicPartitions(srcMeta)
+	s.SrcPartitions = srcParts[topic]
+	if s.SrcOffset, err = newestOffsets(rc.src, topic, s.SrcPartitions); err != nil {
+		return s, err
+	}
+	committed, err := groupOffsets(C.SourceBroker, C.ConsumerGroup, topic, s.SrcPartitions)
+	if err != nil {
+		return s, err
+	}
+	for _, offset := range committed {
+		if offset < 0 {
+			s.Uncommitted++
+			continue
+		}
+		s.Committed += offset
+	}
+	return s, nil
+}
+
+// confirms reports whether the state shows the route replicating the topic since base was
+// read: uReplicator assigned every source partition to a worker and its consumer group either
+// committed progress or has caught up with the source.
+func (s replicationState) confirms(base replicationState, group string) (string, bool) {
+	switch {
+	case !s.Registered || s.Blacklisted:
+		return `not whitelisted`, false
+	case s.SrcPartitions < 1:
+		return `missing from source`, false
+	case s.Partitions < s.SrcPartitions:
+		return fmt.Sprintf("uReplicator has %v of %v source partitions", s.Partitions, s.SrcPartitions), false
+	case s.Online < s.SrcPartitions:
+		return fmt.Sprintf("%v of %v partitions online on uReplicator workers", s.Online, s.SrcPartitions), false
+	case s.Uncommitted > 0:
+		return fmt.Sprintf("consumer group %v has no offset for %v of %v partitions", group, s.Uncommitted, s.SrcPartitions), false
+	case s.Committed > base.Committed:
+		return fmt.Sprintf("replicating, consumer group %v advanced by %v with lag %v", group, s.Committed-base.Committed, s.SrcOffset-s.Committed), true
+	case s.Committed >= s.SrcOffset:
+		return fmt.Sprintf("replicating, consumer group %v caught up with source", group), true
+	default:
+		return fmt.Sprintf("consumer group %v unchanged with lag %v", group, s.SrcOffset-s.Committed), false
+	}
+}
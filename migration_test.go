@@ -0,0 +1,182 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReplicationStateConfirms(t *testing.T) {
+	base := replicationState{Registered: true, Partitions: 3, Online: 3, SrcPartitions: 3, SrcOffset: 100, Committed: 90}
+	tests := []struct {
+		name  string
+		state replicationState
+		want  bool
+	}{
+		{`not registered`, replicationState{SrcPartitions: 3}, false},
+		{`blacklisted`, replicationState{Registered: true, Blacklisted: true, SrcPartitions: 3}, false},
+		{`missing from source`, replicationState{Registered: true}, false},
+		{`partitions not registered`, replicationState{Registered: true, Partitions: 2, Online: 2, SrcPartitions: 3}, false},
+		{`partitions offline`, replicationState{Registered: true, Partitions: 3, Online: 2, SrcPartitions: 3}, false},
+		{`partition without offset`, replicationState{Registered: true, Partitions: 3, Online: 3, SrcPartitions: 3, SrcOffset: 100, Committed: 95, Uncommitted: 1}, false},
+		{`consumer group advanced`, replicationState{Registered: true, Partitions: 3, Online: 3, SrcPartitions: 3, SrcOffset: 120, Committed: 110}, true},
+		{`consumer group caught up`, replicationState{Registered: true, Partitions: 3, Online: 3, SrcPartitions: 3, SrcOffset: 90, Committed: 90}, true},
+		{`consumer group stalled`, replicationState{Registered: true, Partitions: 3, Online: 3, SrcPartitions: 3, SrcOffset: 120, Committed: 90}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, ok := tt.state.confirms(base, `ureplicator`)
+			if ok != tt.want {
+				t.Errorf("confirms = %v (%v); want %v", ok, check, tt.want)
+			}
+		})
+	}
+}
+
+func newTestMigration(id string) Migration {
+	m := Migration{ID: id, State: migrationRunning}
+	for _, name := range []string{stepAdd, stepConfirm, stepBlacklist} {
+		m.Steps = append(m.Steps, MigrationStep{Name: name, State: migrationPending})
+	}
+	return m
+}
+
+func TestMigrationStoreResume(t *testing.T) {
+	store := &migrationStore{jobs: make(map[string]*Migration), aborts: make(map[string]chan struct{})}
+	aborted := newTestMigration(`aborted`)
+	aborted.AbortedBy = `ops`
+	abort, ok := store.add(aborted)
+	if !ok {
+		t.Fatalf("add of %v failed", aborted.ID)
+	}
+	select {
+	case <-abort:
+	default:
+		t.Errorf("abort channel of a resumed aborted migration is open")
+	}
+	if _, ok := store.begin(aborted.ID, stepAdd); ok {
+		t.Errorf("aborted migration began a step")
+	}
+	if _, ok := store.add(aborted); ok {
+		t.Errorf("migration added twice")
+	}
+	store.release(aborted.ID)
+	if _, ok := store.get(aborted.ID); ok {
+		t.Errorf("released migration still runs")
+	}
+}
+
+func TestMigrationAbortable(t *testing.T) {
+	store := &migrationStore{jobs: make(map[string]*Migration), aborts: make(map[string]chan struct{})}
+	m := newTestMigration(`running`)
+	abort, _ := store.add(m)
+	if _, ok, err := store.abort(`missing`, `ops`, false); ok || err != nil {
+		t.Errorf("abort of a migration not running here = %v, %v", ok, err)
+	}
+	store.end(m.ID, stepAdd, migrationSucceeded, ``, nil)
+	got, ok, err := store.abort(m.ID, `ops`, true)
+	if !ok || err != nil || got.AbortedBy != `ops` || !got.Revert {
+		t.Fatalf("abort = %+v, %v, %v", got, ok, err)
+	}
+	<-abort
+	if _, _, err := store.abort(m.ID, `ops`, true); err == nil {
+		t.Errorf("migration aborted twice")
+	}
+	blacklisting := newTestMigration(`blacklisting`)
+	blacklisting.step(stepBlacklist).State = migrationRunning
+	if err := blacklisting.abortable(); err == nil {
+		t.Errorf("migration blacklisting on the old route is abortable")
+	}
+	done := store.finish(m.ID, migrationAborted, ``)
+	if done.step(stepConfirm).State != migrationSkipped {
+		t.Errorf("pending step state = %v; want %v", done.step(stepConfirm).State, migrationSkipped)
+	}
+}
+
+// withMigrations runs a test against an empty migration store.
+func withMigrations(t *testing.T) {
+	t.Helper()
+	logger = zap.NewNop()
+	saved := migrations
+	migrations = &migrationStore{jobs: make(map[string]*Migration), aborts: make(map[string]chan struct{})}
+	t.Cleanup(func() { migrations = saved })
+}
+
+func TestMigrationResumable(t *testing.T) {
+	withMigrations(t)
+	config := &Config{Clusters: map[string]Cluster{`atl-atl`: {}, `atl-dal`: {}}}
+	migration := func(id, from, to string, done ...string) Migration {
+		m := newTestMigration(id)
+		m.From, m.To = from, to
+		for _, name := range done {
+			m.step(name).State = migrationSucceeded
+		}
+		return m
+	}
+	finished := migration(`finished`, `atl-atl`, `atl-dal`, stepAdd, stepConfirm, stepBlacklist)
+	finished.State = migrationSucceeded
+	running := migration(`running`, `atl-atl`, `atl-dal`)
+	migrations.add(running)
+	left := migration(`left`, `atl-atl`, `atl-dal`, stepAdd, stepConfirm)
+	removed := migration(`removed`, `atl-atl`, `atl-ord`, stepAdd)
+
+	resume, orphaned := resumable(config, []Migration{finished, running, left, removed})
+	if len(resume) != 1 || resume[0].ID != `left` {
+		t.Errorf("resume = %+v; want only the migration left by the previous leader", resume)
+	}
+	if len(orphaned) != 1 || orphaned[0].ID != `removed` {
+		t.Errorf("orphaned = %+v; want only the migration of a removed route", orphaned)
+	}
+}
+
+func TestMigrationRunHandsOff(t *testing.T) {
+	withMigrations(t)
+	setLeader(false)
+	m := newTestMigration(`handoff`)
+	m.From, m.To = `atl-atl`, `atl-dal`
+	m.step(stepAdd).State = migrationSucceeded
+	abort, _ := migrations.add(m)
+	r := &migrationRun{id: m.ID, req: MigrationRequest{Topic: `orders`, From: `atl-atl`, To: `atl-dal`}, abort: abort}
+	r.run()
+	if _, ok := migrations.get(m.ID); ok {
+		t.Errorf("migration still runs on a node that is no longer the leader")
+	}
+	if resume, _ := resumable(&Config{Clusters: map[string]Cluster{`atl-atl`: {}, `atl-dal`: {}}}, []Migration{m}); len(resume) != 1 {
+		t.Errorf("migration handed off is not resumed by the next leader")
+	}
+}
+
+func TestMigrationProtected(t *testing.T) {
+	withMigrations(t)
+	protect, err := compilePatterns(`orders\..*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Clusters: map[string]Cluster{
+		`atl-atl`: {protect: protect},
+		`atl-dal`: {ConsumerGroup: `ureplicator`},
+	}}
+	if _, err := startMigration(config, MigrationRequest{Topic: `orders.v1`, From: `atl-atl`, To: `atl-dal`}, `ops`); err == nil {
+		t.Errorf("migration of a topic protected on the old route started")
+	}
+	r := &migrationRun{id: `protected`, req: MigrationRequest{Topic: `orders.v1`, From: `atl-atl`, To: `atl-dal`}, from: config.Clusters[`atl-atl`]}
+	if _, results, err := r.blacklist(); err == nil || len(results) > 0 {
+		t.Errorf("blacklist of a protected topic = %v, %v; want an error before any request", results, err)
+	}
+}
+
+func TestMigrationExecute(t *testing.T) {
+	withMigrations(t)
+	config := &Config{Clusters: map[string]Cluster{
+		`atl-atl`: {Execute: true},
+		`atl-dal`: {ConsumerGroup: `ureplicator`},
+	}}
+	want := `route atl-dal may not change: execute is off`
+	if _, err := startMigration(config, MigrationRequest{Topic: `orders.v1`, From: `atl-atl`, To: `atl-dal`}, `ops`); err == nil || err.Error() != want {
+		t.Errorf("migration to a route that does not execute = %v; want %v", err, want)
+	}
+	r := &migrationRun{id: `noexec`, req: MigrationRequest{Topic: `orders.v1`, From: `atl-atl`, To: `atl-dal`}, to: config.Clusters[`atl-dal`]}
+	if _, results, err := r.revert(Migration{Whitelisted: true}); err == nil || len(results) > 0 {
+		t.Errorf("revert on a route that does not execute = %v, %v; want an error before any request", results, err)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiVersionPrefix = `/v1/`
+	openAPIVersion   = `3.0.3`
+)
+
+var pathParamRegex = regexp.MustCompile(`{([^}:]+)(:[^}]+)?}`)
+
+// openAPISpec generates the OpenAPI document for the versioned routes from the route table.
+func openAPISpec(routes []apiRoute) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, apiVersionPrefix) || route.Method == "" {
+			continue
+		}
+		path := pathParamRegex.ReplaceAllString(route.Path, `{$1}`)
+		op := map[string]interface{}{
+			`summary`:     route.Summary,
+			`operationId`: operationID(route),
+			`x-skrr-role`: route.Role.String(),
+			`responses`:   openAPIResponses(route, schemas),
+		}
+		var params []interface{}
+		for _, m := range pathParamRegex.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]interface{}{
+				`name`:     m[1],
+				`in`:       `path`,
+				`required`: true,
+				`schema`:   map[string]interface{}{`type`: `string`},
+			})
+		}
+		for _, q := range route.Query {
+			params = append(params, map[string]interface{}{
+				`name`:   q,
+				`in`:     `query`,
+				`schema`: map[string]interface{}{`type`: `string`},
+			})
+		}
+		if len(params) > 0 {
+			op[`parameters`] = params
+		}
+		if route.Request != nil {
+			op[`requestBody`] = map[string]interface{}{
+				`content`: map[string]interface{}{
+					`application/json`: map[string]interface{}{`schema`: schemaFor(reflect.TypeOf(route.Request), schemas)},
+				},
+			}
+		}
+		switch route.Role {
+		case roleRead, roleOperator:
+			op[`security`] = []interface{}{map[string]interface{}{`bearerAuth`: []string{}}}
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+	return map[string]interface{}{
+		`openapi`: openAPIVersion,
+		`info`: map[string]interface{}{
+			`title`:   defaultAppName,
+			`version`: strings.Trim(apiVersionPrefix, `/`),
+		},
+		`paths`: paths,
+		`components`: map[string]interface{}{
+			`schemas`: schemas,
+			`securitySchemes`: map[string]interface{}{
+				`bearerAuth`: map[string]interface{}{`type`: `http`, `scheme`: `bearer`},
+			},
+		},
+	}
+}
+
+func operationID(route apiRoute) string {
+	var id string
+	for _, part := range strings.Split(strings.TrimPrefix(route.Path, apiVersionPrefix), `/`) {
+		part = strings.Trim(pathParamRegex.ReplaceAllString(part, `$1`), `{}`)
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.ToLower(route.Method) + id
+}
+
+func openAPIResponses(route apiRoute, schemas map[string]interface{}) map[string]interface{} {
+	ok := map[string]interface{}{`description`: `OK`}
+	switch {
+	case route.ContentType != "":
+		ok[`content`] = map[string]interface{}{route.ContentType: map[string]interface{}{}}
+	case route.Response != nil:
+		ok[`content`] = map[string]interface{}{
+			`application/json`: map[string]interface{}{`schema`: schemaFor(reflect.TypeOf(route.Response), schemas)},
+		}
+	}
+	errResp := map[string]interface{}{
+		`description`: `Error`,
+		`content`: map[string]interface{}{
+			`application/json`: map[string]interface{}{`schema`: schemaFor(reflect.TypeOf(map[string]string{}), schemas)},
+		},
+	}
+	status := strconv.Itoa(http.StatusOK)
+	if route.Status != 0 {
+		status = strconv.Itoa(route.Status)
+	}
+	responses := map[string]interface{}{
+		status:    ok,
+		`default`: errResp,
+	}
+	switch route.Role {
+	case roleRead, roleOperator:
+		responses[`401`] = map[string]interface{}{`description`: `Invalid or missing token`}
+		responses[`403`] = map[string]interface{}{`description`: `Insufficient role`}
+	}
+	return responses
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	enumType          = reflect.TypeOf((*enumerated)(nil)).Elem()
+)
+
+// enumerated is a type that marshals to one of a fixed set of strings.
+type enumerated interface {
+	enumValues() []string
+}
+
+// schemaFor reflects a JSON schema for t, registering named structs as components.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{`type`: `string`, `format`: `date-time`}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		ref := map[string]interface{}{`$ref`: `#/components/schemas/` + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+		props := make(map[string]interface{})
+		schemas[name] = map[string]interface{}{`type`: `object`, `properties`: props}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			tag := strings.Split(f.Tag.Get(`json`), `,`)[0]
+			switch tag {
+			case `-`:
+				continue
+			case ``:
+				tag = f.Name
+			}
+			props[tag] = schemaFor(f.Type, schemas)
+		}
+		return ref
+	case t.Implements(textMarshalerType):
+		schema := map[string]interface{}{`type`: `string`}
+		if t.Implements(enumType) {
+			schema[`enum`] = reflect.Zero(t).Interface().(enumerated).enumValues()
+		}
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{`type`: `string`}
+	case reflect.Bool:
+		return map[string]interface{}{`type`: `boolean`}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{`type`: `integer`}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{`type`: `number`}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{`type`: `array`, `items`: schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{`type`: `object`, `additionalProperties`: schemaFor(t.Elem(), schemas)}
+	}
+	return map[string]interface{}{}
+}
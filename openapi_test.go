@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaForTextMarshaler(t *testing.T) {
+	schemas := make(map[string]interface{})
+	schemaFor(reflect.TypeOf(Plan{}), schemas)
+	props := schemas[`PlanAction`].(map[string]interface{})[`properties`].(map[string]interface{})
+	want := map[string]interface{}{
+		`type`: `string`,
+		`enum`: []string{`both`, `blacklist`, `whitelist`, `expand`, `config`, `onboard`, `create`},
+	}
+	if got := props[`action`]; !reflect.DeepEqual(got, want) {
+		t.Errorf("PlanAction.action schema = %v; want %v", got, want)
+	}
+	props = schemas[`Plan`].(map[string]interface{})[`properties`].(map[string]interface{})
+	if got := props[`mode`]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan.mode schema = %v; want %v", got, want)
+	}
+	if got, want := props[`created`], map[string]interface{}{`type`: `string`, `format`: `date-time`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Plan.created schema = %v; want %v", got, want)
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/jbvmio/kafka"
 	"go.uber.org/zap"
 )
 
@@ -16,215 +20,477 @@ const (
 	apiTopicPath = `/topics`
 )
 
-var replicationTarget string
-
-func getZKTopics(zkRoot string) []string {
-	path := zkRoot + `/` + replicationTarget
-	return zkListTopics(path)
+func (rc *routeClient) getZKTopics(zkRoot string) []string {
+	path := zkRoot + `/` + rc.target
+	return rc.zkListTopics(path)
 }
 
-func getZKBlacklist(zkRoot string) []string {
-	path := zkRoot + `/` + replicationTarget
-	return zkListBlacklist(path)
+func (rc *routeClient) getZKBlacklist(zkRoot string) []string {
+	path := zkRoot + `/` + rc.target
+	return rc.zkListBlacklist(path)
 }
 
-func getZKTarget(zkRoot, cluster string) error {
-	dcList := zkLS(zkRoot)
+func (rc *routeClient) getZKTarget(zkRoot, cluster string) error {
+	rc.target = ""
+	dcList := rc.zkLS(zkRoot)
 	switch {
 	case len(dcList) < 1:
 		return fmt.Errorf("No DC Replications Found")
 	case cluster == `adhoc`:
 		switch {
 		case len(dcList) == 1:
-			replicationTarget = dcList[0]
+			rc.target = dcList[0]
 		default:
 			return fmt.Errorf("Multiple Replications Found: %v", dcList)
 		}
 	default:
 		for _, dc := range dcList {
 			if dc == cluster {
-				replicationTarget = dc
+				rc.target = dc
 				break
 			}
 		}
 	}
-	if replicationTarget == "" {
+	if rc.target == "" {
 		return fmt.Errorf("No Replications found for %v", cluster)
 	}
 	return nil
 }
 
-func filterDeletedTopics(zkRoot string) []string {
+// gatherSnapshot reads the replication state of a route from ZooKeeper and both Kafka clusters.
+// When configKeys are given, their values are read for every replicated topic on both clusters.
+func (rc *routeClient) gatherSnapshot(zkRoot string, configKeys ...string) (Snapshot, error) {
 	var (
-		removeTopics []string
-		dstTopics    []string
-		srcTopics    []string
-		dstErr       error
-		srcErr       error
-		zkTopics     = getZKTopics(zkRoot)
-		blTopics     = getZKBlacklist(zkRoot)
-		blRegex      = makeRegex(blTopics...)
-		wg           sync.WaitGroup
+		dstMeta []kafka.TopicMeta
+		srcMeta []kafka.TopicMeta
+		dstErr  error
+		srcErr  error
+		wg      sync.WaitGroup
 	)
-	if len(zkTopics) < 1 || len(blTopics) < 1 {
-		return removeTopics
+	snap := Snapshot{
+		Route:     rc.name,
+		Taken:     time.Now(),
+		ZKTopics:  rc.getZKTopics(zkRoot),
+		Blacklist: rc.getZKBlacklist(zkRoot),
 	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		dstTopics, dstErr = getKafkaTopics(dstKafkaClient)
+		dstMeta, dstErr = rc.dst.GetTopicMeta()
 	}()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		srcTopics, srcErr = getKafkaTopics(srcKafkaClient)
+		srcMeta, srcErr = rc.src.GetTopicMeta()
 	}()
 	wg.Wait()
 	switch {
 	case dstErr != nil && srcErr != nil:
-		logger.Error("Error connecting to both source and destination kafka clusters", zap.Errors("errstack", []error{srcErr, dstErr}))
+		return snap, fmt.Errorf("unable to read both source and destination kafka clusters: %v; %v", srcErr, dstErr)
 	case dstErr != nil:
-		logger.Error("Error connecting to destination kafka cluster", zap.Error(dstErr))
+		return snap, fmt.Errorf("unable to read destination kafka cluster: %v", dstErr)
 	case srcErr != nil:
-		logger.Error("Error connecting to source kafka cluster", zap.Error(srcErr))
-	default:
-		dstRegex := makeRegex(dstTopics...)
-		srcRegex := makeRegex(srcTopics...)
-		for _, topic := range zkTopics {
-			if !blRegex.MatchString(topic) {
-				if !dstRegex.MatchString(topic) && !srcRegex.MatchString(topic) {
-					removeTopics = append(removeTopics, topic)
-				}
-			}
-		}
+		return snap, fmt.Errorf("unable to read source kafka cluster: %v", srcErr)
 	}
-	return removeTopics
-}
-
-func filterReAddedTopics(zkRoot string) []string {
-	var (
-		addedTopics []string
-		dstTopics   []string
-		srcTopics   []string
-		dstErr      error
-		srcErr      error
-		blTopics    = getZKBlacklist(zkRoot)
-		dstRegex    = makeRegex(dstTopics...)
-		srcRegex    = makeRegex(srcTopics...)
-		wg          sync.WaitGroup
-	)
-	if len(blTopics) < 1 {
-		return addedTopics
+	snap.SrcTopics, snap.SrcPartitions = topicPartitions(srcMeta)
+	snap.DstTopics, snap.DstPartitions = topicPartitions(dstMeta)
+	var err error
+	snap.ReplPartitions, err = rc.zkListPartitions(zkRoot+`/`+rc.target, snap.replicated()...)
+	if err != nil {
+		return snap, fmt.Errorf("unable to read uReplicator partitions: %v", err)
+	}
+	if len(configKeys) < 1 {
+		return snap, nil
+	}
+	srcSet := newTopicSet(snap.SrcTopics...)
+	dstSet := newTopicSet(snap.DstTopics...)
+	var topics []string
+	for _, t := range snap.replicated() {
+		if srcSet.has(t) && dstSet.has(t) {
+			topics = append(topics, t)
+		}
 	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		dstTopics, dstErr = getKafkaTopics(dstKafkaClient)
+		snap.SrcConfigs, srcErr = describeTopicConfigs(rc.src, topics, configKeys...)
 	}()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		srcTopics, srcErr = getKafkaTopics(srcKafkaClient)
+		snap.DstConfigs, dstErr = describeTopicConfigs(rc.dst, topics, configKeys...)
 	}()
 	wg.Wait()
 	switch {
-	case dstErr != nil && srcErr != nil:
-		logger.Error("Error connecting to both source and destination kafka clusters", zap.Errors("errstack", []error{srcErr, dstErr}))
-	case dstErr != nil:
-		logger.Error("Error connecting to destination kafka cluster", zap.Error(dstErr))
 	case srcErr != nil:
-		logger.Error("Error connecting to source kafka cluster", zap.Error(srcErr))
-	default:
-		for _, topic := range blTopics {
-			if dstRegex.MatchString(topic) && srcRegex.MatchString(topic) {
-				addedTopics = append(addedTopics, topic)
+		return snap, fmt.Errorf("unable to read source topic configs: %v", srcErr)
+	case dstErr != nil:
+		return snap, fmt.Errorf("unable to read destination topic configs: %v", dstErr)
+	}
+	return snap, nil
+}
+
+func topicPartitions(meta []kafka.TopicMeta) ([]string, map[string]int) {
+	parts := make(map[string]int)
+	for _, m := range meta {
+		parts[m.Topic]++
+	}
+	topics := make([]string, 0, len(parts))
+	for t := range parts {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics, parts
+}
+
+// ActionResult is the outcome of a single request made while executing a Plan.
+type ActionResult struct {
+	Action     reconcileAction   `json:"action"`
+	Topic      string            `json:"topic"`
+	Partitions int               `json:"partitions,omitempty"`
+	Configs    map[string]string `json:"configs,omitempty"`
+	Time       time.Time         `json:"time"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	Response   string            `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Inverse    *InverseOp        `json:"inverse,omitempty"`
+}
+
+// InverseOp is the operation that undoes a successful ActionResult.
+type InverseOp struct {
+	Action     reconcileAction   `json:"action"`
+	Topic      string            `json:"topic"`
+	Partitions int               `json:"partitions,omitempty"`
+	Configs    map[string]string `json:"configs,omitempty"`
+}
+
+// setInverse records how to undo the result. Blacklists are undone by a re-add with the
+// registered partition count, whitelists by a blacklist and config changes by restoring the
+// previous values. Expansions and topic creation cannot be undone.
+func (r *ActionResult) setInverse(previous map[string]string) {
+	if !r.succeeded() {
+		return
+	}
+	switch r.Action {
+	case blacklistAction:
+		r.Inverse = &InverseOp{Action: whitelistAction, Topic: r.Topic, Partitions: r.Partitions}
+	case whitelistAction, onboardAction:
+		r.Inverse = &InverseOp{Action: blacklistAction, Topic: r.Topic}
+	case configAction:
+		if len(previous) > 0 {
+			r.Inverse = &InverseOp{Action: configAction, Topic: r.Topic, Configs: previous}
+		}
+	}
+}
+
+// succeeded reports whether the request was made and not refused.
+func (r ActionResult) succeeded() bool {
+	return r.Error == "" && (r.StatusCode == 0 || r.StatusCode < 300)
+}
+
+// executePlan applies the actions of a Plan to the route's uReplicator and returns the outcome
+// of every request made. Requests not yet sent when ctx is done are skipped.
+func (rc *routeClient) executePlan(ctx context.Context, C Cluster, plan Plan) []ActionResult {
+	L := logger.With(zap.String("Cluster", plan.Route))
+	var results []ActionResult
+	if topics := plan.topics(blacklistAction); len(topics) > 0 {
+		L.Info("Blacklisting Topics ...", zap.Int("Count", len(topics)))
+		results = append(results, blacklistTopics(ctx, plan.Route, C.ReplAPI, topics...)...)
+	}
+	for _, a := range plan.Actions {
+		if a.Action == configAction && ctx.Err() == nil {
+			results = append(results, rc.alterConfig(plan.Route, a.Topic, a.Configs))
+		}
+	}
+	topicParts := make(map[string]int)
+	for _, a := range plan.Actions {
+		if a.Action != whitelistAction && a.Action != onboardAction {
+			continue
+		}
+		if a.Create {
+			if ctx.Err() != nil {
+				continue
 			}
+			res := rc.createTopic(C, plan.Route, a.Topic, a.Partitions)
+			results = append(results, res)
+			if !res.succeeded() {
+				continue
+			}
+		}
+		topicParts[a.Topic] = a.Partitions
+	}
+	if len(topicParts) > 0 {
+		L.Info("Whitelisting Topics ...", zap.Int("Count", len(topicParts)))
+		results = append(results, whitelistTopics(ctx, plan.Route, C.ReplAPI, topicParts)...)
+	}
+	expandParts := make(map[string]int)
+	for _, a := range plan.Actions {
+		if a.Action == expandAction {
+			expandParts[a.Topic] = a.Partitions
+		}
+	}
+	if len(expandParts) > 0 {
+		L.Info("Expanding Topics ...", zap.Int("Count", len(expandParts)))
+		results = append(results, expandTopics(ctx, plan.Route, C.ReplAPI, expandParts)...)
+	}
+	previous := make(map[string]map[string]string)
+	for _, d := range plan.Configs {
+		if previous[d.Topic] == nil {
+			previous[d.Topic] = make(map[string]string)
+		}
+		previous[d.Topic][d.Config] = d.Destination
+	}
+	parts := make(map[string]int)
+	leased := make(topicSet)
+	for _, a := range plan.Actions {
+		if a.Action == blacklistAction {
+			parts[a.Topic] = a.Partitions
+			if a.Lease {
+				leased[a.Topic] = struct{}{}
+			}
+		}
+	}
+	for i := range results {
+		if results[i].Action == blacklistAction {
+			results[i].Partitions = parts[results[i].Topic]
+		}
+		results[i].setInverse(previous[results[i].Topic])
+		// A topic blacklisted when its lease expired is owned by the lease, so it is never
+		// whitelisted again, even with whitelistunowned set.
+		if results[i].Action == blacklistAction && leased.has(results[i].Topic) {
+			rc.endLease(C.StatePath, results[i])
+			continue
 		}
+		rc.trackOwnership(C.StatePath, results[i])
 	}
-	return addedTopics
+	return results
 }
 
-func filterArgsTopics(args, topics []string) []string {
-	var filtered []string
-	regex := makeRegex(args...)
-	for _, topic := range topics {
-		if regex.MatchString(topic) {
-			filtered = append(filtered, topic)
+// createTopic creates a topic on the destination before it is whitelisted.
+func (rc *routeClient) createTopic(C Cluster, replName, topic string, parts int) ActionResult {
+	L := logger.With(zap.String("Request", "Create"), zap.String("Cluster", replName))
+	res := ActionResult{Action: createAction, Topic: topic, Partitions: parts, Time: time.Now()}
+	publishEvent(eventCreateRequest, replName, topic, "Creating destination topic", map[string]interface{}{
+		`partitions`:        parts,
+		`replicationFactor`: C.ReplicationFactor,
+	})
+	configs, err := rc.createDestinationTopic(topic, parts, C.ReplicationFactor, C.TopicConfigs...)
+	res.Configs = configs
+	if err != nil {
+		L.Error("received error", zap.String("Topic", topic), zap.Error(err))
+		publishError(replName, topic, "Create request failed, topic not whitelisted", err)
+		res.Error = err.Error()
+		return res
+	}
+	L.Info("Created Destination Topic", zap.String("Topic", topic), zap.Int("Partitions", parts), zap.Int("ReplicationFactor", C.ReplicationFactor), zap.Any("Configs", configs))
+	publishEvent(eventCreateResponse, replName, topic, "Created destination topic", map[string]interface{}{`configs`: configs})
+	return res
+}
+
+// addTopic whitelists a source topic on the route, creating it on the destination first when
+// it is missing and the route may create topics. Partitions default to the source partition
+// count. Every request made is returned, the whitelist with its inverse.
+func (rc *routeClient) addTopic(ctx context.Context, C Cluster, snap Snapshot, topic string, parts int) ([]ActionResult, error) {
+	create := !newTopicSet(snap.DstTopics...).has(topic)
+	switch {
+	case !newTopicSet(snap.SrcTopics...).has(topic):
+		return nil, fmt.Errorf("topic %v is missing from the source of route %v", topic, rc.name)
+	case create && !C.CreateTopics:
+		return nil, fmt.Errorf("topic %v is missing from the destination of route %v and topic creation is disabled", topic, rc.name)
+	}
+	if parts < 1 {
+		parts = snap.SrcPartitions[topic]
+	}
+	var results []ActionResult
+	if create {
+		res := rc.createTopic(C, rc.name, topic, parts)
+		results = append(results, res)
+		if !res.succeeded() {
+			return results, fmt.Errorf("unable to create topic %v: %v", topic, res.Error)
 		}
 	}
-	return filtered
+	res := reAddRequest(ctx, &http.Client{}, rc.name, C.ReplAPI+apiTopicPath, topic, parts)
+	res.setInverse(nil)
+	results = append(results, res)
+	if !res.succeeded() {
+		return results, fmt.Errorf("unable to whitelist topic %v: %v %v", topic, res.StatusCode, res.Error)
+	}
+	return results, nil
+}
+
+func (rc *routeClient) alterConfig(replName, topic string, configs map[string]string) ActionResult {
+	L := logger.With(zap.String("Request", "Config"), zap.String("Cluster", replName))
+	res := ActionResult{Action: configAction, Topic: topic, Configs: configs, Time: time.Now()}
+	publishEvent(eventConfigRequest, replName, topic, "Altering destination topic config", map[string]interface{}{`configs`: configs})
+	if err := rc.alterDestinationConfig(topic, configs); err != nil {
+		L.Error("received error", zap.String("Topic", topic), zap.Error(err))
+		publishError(replName, topic, "Config request failed", err)
+		res.Error = err.Error()
+		return res
+	}
+	L.Info("Altered Destination Topic Config", zap.String("Topic", topic), zap.Any("Configs", configs))
+	publishEvent(eventConfigResponse, replName, topic, "Altered destination topic config", nil)
+	return res
 }
 
-func blacklistTopics(apiURL string, topics ...string) {
+func blacklistTopics(ctx context.Context, replName, apiURL string, topics ...string) []ActionResult {
 	client := &http.Client{}
+	var results []ActionResult
 	for _, topic := range topics {
+		if ctx.Err() != nil {
+			break
+		}
 		url := apiURL + apiTopicPath + `/` + topic
-		deleteRequest(client, url)
+		results = append(results, deleteRequest(ctx, client, replName, topic, url))
 	}
+	return results
 }
 
-func deleteRequest(client *http.Client, urlTarget string) {
+func deleteRequest(ctx context.Context, client *http.Client, replName, topic, urlTarget string) ActionResult {
 	L := logger.With(zap.String("Request", "Blacklist"))
+	res := ActionResult{Action: blacklistAction, Topic: topic, Time: time.Now()}
+	publishEvent(eventBlacklistRequest, replName, topic, "DELETE "+urlTarget, nil)
 	req, err := http.NewRequest("DELETE", urlTarget, nil)
 	if err != nil {
 		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
-		return
+		publishError(replName, topic, "Blacklist request failed", err)
+		res.Error = err.Error()
+		return res
 	}
-	resp, err := client.Do(req)
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
-		return
+		publishError(replName, topic, "Blacklist request failed", err)
+		res.Error = err.Error()
+		return res
 	}
 	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
-		return
+		publishError(replName, topic, "Blacklist request failed", err)
+		res.Error = err.Error()
+		return res
 	}
-	L.Info("Result", zap.String("Response", resp.Status), zap.String("Message", fmt.Sprintf("%s", respBody)))
+	res.Response = fmt.Sprintf("%s", respBody)
+	L.Info("Result", zap.String("Response", resp.Status), zap.String("Message", res.Response))
+	publishEvent(eventBlacklistResponse, replName, topic, resp.Status, map[string]interface{}{`response`: res.Response})
+	return res
 }
 
-func whitelistTopics(apiURL string, topics ...string) {
-	regex := makeRegex(topics...)
-	topicMeta, err := srcKafkaClient.GetTopicMeta()
-	if err != nil {
-		logger.Error("Unable to retrieve source topics from kafka", zap.Error(err))
-	} else {
-		topicParts := make(map[string]int)
-		for _, meta := range topicMeta {
-			if regex.MatchString(meta.Topic) {
-				topicParts[meta.Topic]++
-			}
-		}
-		for topic, parts := range topicParts {
-			url := apiURL + apiTopicPath
-			reAddRequest(url, topic, parts)
+func whitelistTopics(ctx context.Context, replName, apiURL string, topicParts map[string]int) []ActionResult {
+	client := &http.Client{}
+	var results []ActionResult
+	for topic, parts := range topicParts {
+		if ctx.Err() != nil {
+			break
 		}
+		url := apiURL + apiTopicPath
+		results = append(results, reAddRequest(ctx, client, replName, url, topic, parts))
 	}
+	return results
 }
 
-func reAddRequest(urlTarget, topic string, parts int) {
+func reAddRequest(ctx context.Context, client *http.Client, replName, urlTarget, topic string, parts int) ActionResult {
 	L := logger.With(zap.String("Request", "Whitelist"))
+	res := ActionResult{Action: whitelistAction, Topic: topic, Partitions: parts, Time: time.Now()}
+	publishEvent(eventWhitelistRequest, replName, topic, "POST "+urlTarget, map[string]interface{}{`partitions`: parts})
 	j, err := json.Marshal(PostRequest{
 		Topic:         topic,
 		NumPartitions: strconv.Itoa(parts),
 	})
 	if err != nil {
 		L.Error("received marshalling error", zap.String("topic", topic), zap.Error(err))
-		return
+		publishError(replName, topic, "Whitelist request failed", err)
+		res.Error = err.Error()
+		return res
+	}
+	req, err := http.NewRequest("POST", urlTarget, bytes.NewBuffer(j))
+	if err != nil {
+		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
+		publishError(replName, topic, "Whitelist request failed", err)
+		res.Error = err.Error()
+		return res
 	}
-	resp, err := http.Post(urlTarget, `application/json`, bytes.NewBuffer(j))
+	req.Header.Set(`Content-Type`, `application/json`)
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		L.Error("received POST error", zap.String("topic", topic), zap.Error(err))
-		return
+		publishError(replName, topic, "Whitelist request failed", err)
+		res.Error = err.Error()
+		return res
 	}
 	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
-		return
+		publishError(replName, topic, "Whitelist request failed", err)
+		res.Error = err.Error()
+		return res
+	}
+	res.Response = fmt.Sprintf("%s", respBody)
+	publishEvent(eventWhitelistResponse, replName, topic, resp.Status, map[string]interface{}{`response`: res.Response})
+	L.Info("Whitelist Result", zap.String("Topic", topic), zap.String("Response", resp.Status), zap.String("Message", res.Response))
+	return res
+}
+
+func expandTopics(ctx context.Context, replName, apiURL string, topicParts map[string]int) []ActionResult {
+	client := &http.Client{}
+	var results []ActionResult
+	for topic, parts := range topicParts {
+		if ctx.Err() != nil {
+			break
+		}
+		url := apiURL + apiTopicPath
+		results = append(results, expandRequest(ctx, client, replName, url, topic, parts))
+	}
+	return results
+}
+
+func expandRequest(ctx context.Context, client *http.Client, replName, urlTarget, topic string, parts int) ActionResult {
+	L := logger.With(zap.String("Request", "Expand"))
+	res := ActionResult{Action: expandAction, Topic: topic, Partitions: parts, Time: time.Now()}
+	publishEvent(eventExpandRequest, replName, topic, "PUT "+urlTarget, map[string]interface{}{`partitions`: parts})
+	j, err := json.Marshal(PostRequest{
+		Topic:         topic,
+		NumPartitions: strconv.Itoa(parts),
+	})
+	if err != nil {
+		L.Error("received marshalling error", zap.String("topic", topic), zap.Error(err))
+		publishError(replName, topic, "Expand request failed", err)
+		res.Error = err.Error()
+		return res
+	}
+	req, err := http.NewRequest("PUT", urlTarget, bytes.NewBuffer(j))
+	if err != nil {
+		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
+		publishError(replName, topic, "Expand request failed", err)
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		L.Error("received PUT error", zap.String("topic", topic), zap.Error(err))
+		publishError(replName, topic, "Expand request failed", err)
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		L.Error("received error", zap.String("URL", urlTarget), zap.Error(err))
+		publishError(replName, topic, "Expand request failed", err)
+		res.Error = err.Error()
+		return res
 	}
-	L.Info("Whitelist Result", zap.String("Topic", topic), zap.String("Response", resp.Status), zap.String("Message", fmt.Sprintf("%s", respBody)))
+	res.Response = fmt.Sprintf("%s", respBody)
+	publishEvent(eventExpandResponse, replName, topic, resp.Status, map[string]interface{}{`response`: res.Response})
+	L.Info("Expand Result", zap.String("Topic", topic), zap.String("Response", resp.Status), zap.String("Message", res.Response))
+	return res
 }
 
 // PostRequest .
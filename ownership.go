@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	gozk "github.com/samuel/go-zookeeper/zk"
+	"go.uber.org/zap"
+)
+
+const (
+	// ownedPath holds a node per blacklist entry a route created itself, under its state path.
+	ownedPath = `/owned`
+	// migratedPath holds a node per blacklist entry a migration created once the topic
+	// replicated on another route, under the state path of the route it left.
+	migratedPath = `/migrated`
+	// expiredPath holds a node per blacklist entry made when the topic's replication lease
+	// expired, under the route's state path.
+	expiredPath = `/expired`
+
+	ownerSkrr      = `skrr`
+	ownerOperator  = `operator`
+	ownerMigration = `migration`
+	ownerLease     = `lease`
+	ruleOwner      = `owner`
+)
+
+// ownerPaths maps the ownership records under a route's state path to the owner they record.
+var ownerPaths = []struct{ path, owner string }{
+	{ownedPath, ownerSkrr},
+	{migratedPath, ownerMigration},
+	{expiredPath, ownerLease},
+}
+
+// BlacklistEntry is a topic on a route's uReplicator blacklist and who owns it. Only entries
+// owned by skrr are whitelisted automatically, and entries owned by a migration or an expired
+// lease never are.
+type BlacklistEntry struct {
+	Topic string    `json:"topic"`
+	Owner string    `json:"owner"`
+	Since time.Time `json:"since,omitempty"`
+	By    string    `json:"by,omitempty"`
+}
+
+// ownershipRecord is the data of an owned blacklist entry node.
+type ownershipRecord struct {
+	Time time.Time `json:"time"`
+	By   string    `json:"by"`
+}
+
+func (rc *routeClient) ownedChildren(path string) ([]string, error) {
+	children, err := rc.zk.Children(path)
+	switch {
+	case err == gozk.ErrNoNode:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to read %v: %v", path, err)
+	}
+	return children, nil
+}
+
+// readOwnership sets the blacklisted topics the route owns, those a migration owns and those
+// blacklisted when their lease expired on snap, and returns the topics it holds records of that
+// are no longer blacklisted. Nothing is changed.
+func (rc *routeClient) readOwnership(statePath string, snap *Snapshot) (stale []string, err error) {
+	blSet := newTopicSet(snap.Blacklist...)
+	staleSet := make(topicSet)
+	snap.Owned, snap.Migrated, snap.Expired = nil, nil, nil
+	for _, r := range ownerPaths {
+		children, err := rc.ownedChildren(statePath + r.path)
+		if err != nil {
+			return nil, err
+		}
+		var topics []string
+		for _, topic := range children {
+			if blSet.has(topic) {
+				topics = append(topics, topic)
+				continue
+			}
+			if !staleSet.has(topic) {
+				staleSet[topic] = struct{}{}
+				stale = append(stale, topic)
+			}
+		}
+		sort.Strings(topics)
+		switch r.owner {
+		case ownerSkrr:
+			snap.Owned = topics
+		case ownerMigration:
+			snap.Migrated = topics
+		case ownerLease:
+			snap.Expired = topics
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// pruneOwnership drops the records of owned topics no longer blacklisted, so a later manual
+// blacklist of them is not taken for the route's own.
+func (rc *routeClient) pruneOwnership(statePath string, stale []string) {
+	for _, topic := range stale {
+		if err := rc.releaseOwned(statePath, topic); err != nil {
+			logger.Warn("Unable to drop blacklist ownership", zap.String("Cluster", rc.name), zap.String("Topic", topic), zap.Error(err))
+		}
+	}
+}
+
+func (rc *routeClient) recordOwner(path, by string) error {
+	data, err := json.Marshal(ownershipRecord{Time: time.Now(), By: by})
+	if err != nil {
+		return err
+	}
+	_, err = rc.zk.Create(path, data, "", true)
+	if err == gozk.ErrNodeExists {
+		_, err = rc.zk.Set(path, data)
+	}
+	return err
+}
+
+// recordOwned marks a blacklisted topic as owned by the route.
+func (rc *routeClient) recordOwned(statePath, topic, by string) error {
+	return rc.recordOwner(statePath+ownedPath+`/`+topic, by)
+}
+
+// recordExpired marks a topic as blacklisted when its lease expired.
+func (rc *routeClient) recordExpired(statePath, topic, by string) error {
+	if err := rc.releaseOwned(statePath, topic); err != nil {
+		return err
+	}
+	return rc.recordOwner(statePath+expiredPath+`/`+topic, by)
+}
+
+// releaseOwned drops every ownership record of a topic.
+func (rc *routeClient) releaseOwned(statePath, topic string) error {
+	for _, r := range ownerPaths {
+		if err := rc.zk.Delete(statePath + r.path + `/` + topic); err != nil && err != gozk.ErrNoNode {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackOwnership records the route as the owner of the topics it blacklisted and drops its
+// ownership of the topics it whitelisted.
+func (rc *routeClient) trackOwnership(statePath string, res ActionResult) {
+	if !res.succeeded() {
+		return
+	}
+	var err error
+	switch res.Action {
+	case blacklistAction:
+		err = rc.recordOwned(statePath, res.Topic, ownerSkrr)
+	case whitelistAction:
+		err = rc.releaseOwned(statePath, res.Topic)
+	default:
+		return
+	}
+	if err != nil {
+		logger.Warn("Unable to update blacklist ownership", zap.String("Cluster", rc.name), zap.String("Topic", res.Topic), zap.String("Action", res.Action.String()), zap.Error(err))
+	}
+}
+
+// listBlacklist returns every entry of the route's blacklist with its owner.
+func (rc *routeClient) listBlacklist(zkRoot, statePath string) ([]BlacklistEntry, error) {
+	blacklist := rc.getZKBlacklist(zkRoot)
+	conn, _, err := gozk.Connect(rc.zkServers, time.Second*10, gozk.WithLogInfo(false))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to zookeeper: %v", err)
+	}
+	defer conn.Close()
+	sort.Strings(blacklist)
+	entries := make([]BlacklistEntry, 0, len(blacklist))
+	for _, topic := range blacklist {
+		entry := BlacklistEntry{Topic: topic, Owner: ownerOperator}
+		for _, r := range ownerPaths {
+			path := statePath + r.path + `/` + topic
+			data, _, err := conn.Get(path)
+			switch {
+			case err == gozk.ErrNoNode:
+				continue
+			case err != nil:
+				return nil, fmt.Errorf("unable to read %v: %v", path, err)
+			}
+			var record ownershipRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				logger.Warn("Unable to parse blacklist ownership", zap.String("path", path), zap.Error(err))
+			}
+			entry.Owner = r.owner
+			entry.Since = record.Time
+			entry.By = record.By
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// setBlacklistOwner makes skrr, the operators or a migration the owner of a topic on a route's
+// blacklist. identity is the migration ID for a migration.
+func setBlacklistOwner(C Cluster, route, topic, owner, identity string) (BlacklistEntry, error) {
+	rc := newRouteClient(route)
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return BlacklistEntry{}, err
+	}
+	if err := rc.getZKTarget(C.ZKRoot, route); err != nil {
+		return BlacklistEntry{}, err
+	}
+	if !newTopicSet(rc.getZKBlacklist(C.ZKRoot)...).has(topic) {
+		return BlacklistEntry{}, fmt.Errorf("topic %v is not blacklisted on route %v", topic, route)
+	}
+	entry := BlacklistEntry{Topic: topic, Owner: owner}
+	if err := rc.releaseOwned(C.StatePath, topic); err != nil {
+		return entry, err
+	}
+	if owner == ownerOperator {
+		return entry, nil
+	}
+	entry.Since, entry.By = time.Now(), identity
+	if owner == ownerMigration {
+		return entry, rc.recordOwner(C.StatePath+migratedPath+`/`+topic, identity)
+	}
+	return entry, rc.recordOwned(C.StatePath, topic, identity)
+}
+
+// filterUnownedTopics keeps whitelist actions for blacklist entries a migration or an expired
+// lease owns out of a plan, and those for entries the route does not own unless whitelistUnowned
+// is set, reporting them as excluded.
+func filterUnownedTopics(snap Snapshot, whitelistUnowned bool, actions []PlanAction) ([]PlanAction, []PlanExclusion) {
+	ownedSet := newTopicSet(snap.Owned...)
+	migratedSet := newTopicSet(snap.Migrated...)
+	expiredSet := newTopicSet(snap.Expired...)
+	kept := []PlanAction{}
+	var excluded []PlanExclusion
+	for _, a := range actions {
+		switch {
+		case a.Action != whitelistAction:
+		case migratedSet.has(a.Topic):
+			excluded = append(excluded, PlanExclusion{Action: a.Action, Topic: a.Topic, Rule: ruleOwner, Pattern: ownerMigration})
+			continue
+		case expiredSet.has(a.Topic):
+			excluded = append(excluded, PlanExclusion{Action: a.Action, Topic: a.Topic, Rule: ruleOwner, Pattern: ownerLease})
+			continue
+		case !whitelistUnowned && !ownedSet.has(a.Topic):
+			excluded = append(excluded, PlanExclusion{Action: a.Action, Topic: a.Topic, Rule: ruleOwner, Pattern: ownerOperator})
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept, excluded
+}
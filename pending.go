@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PendingCandidate is a topic a route has planned an action for, tracked until it has been
+// seen for enough consecutive cycles and long enough to qualify.
+type PendingCandidate struct {
+	Route     string          `json:"route"`
+	Topic     string          `json:"topic"`
+	Action    reconcileAction `json:"action"`
+	Reason    string          `json:"reason"`
+	FirstSeen time.Time       `json:"firstSeen"`
+	LastSeen  time.Time       `json:"lastSeen"`
+	Cycles    int             `json:"cycles"`
+	Qualified bool            `json:"qualified"`
+}
+
+// pendingTracker counts the confirmation cycles of each route's candidates. It is only held in
+// memory, so a new leader starts every count over.
+type pendingTracker struct {
+	routes map[string]map[string]*PendingCandidate
+	mu     sync.RWMutex
+}
+
+var pendingCandidates = &pendingTracker{
+	routes: make(map[string]map[string]*PendingCandidate),
+}
+
+// observe records the actions planned for a route this cycle and splits them into those that
+// qualify and those still held. Candidates missing from this cycle start over, except those
+// outside only when the cycle was limited to topics matching it. Onboarded topics must also
+// have been seen for the settle delay.
+func (t *pendingTracker) observe(route string, actions []PlanAction, only patternList, confirmations int, grace, settle time.Duration, now time.Time) (ready, held []PlanAction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev := t.routes[route]
+	next := make(map[string]*PendingCandidate, len(actions))
+	if len(only) > 0 {
+		for key, c := range prev {
+			if _, ok := only.match(c.Topic); !ok {
+				next[key] = c
+			}
+		}
+	}
+	ready, held = splitCandidates(route, prev, next, actions, confirmations, grace, settle, now)
+	t.routes[route] = next
+	return ready, held
+}
+
+// preview splits the actions planned for a route as observe would, without counting the cycle.
+func (t *pendingTracker) preview(route string, actions []PlanAction, confirmations int, grace, settle time.Duration, now time.Time) (ready, held []PlanAction) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	next := make(map[string]*PendingCandidate, len(actions))
+	return splitCandidates(route, t.routes[route], next, actions, confirmations, grace, settle, now)
+}
+
+// splitCandidates counts a cycle of actions against the candidates in prev, adding them to
+// next, and splits the actions into those that qualify and those still held. prev is not changed.
+func splitCandidates(route string, prev, next map[string]*PendingCandidate, actions []PlanAction, confirmations int, grace, settle time.Duration, now time.Time) (ready, held []PlanAction) {
+	for _, a := range actions {
+		key := a.Action.String() + `/` + a.Topic
+		c := PendingCandidate{
+			Route:     route,
+			Topic:     a.Topic,
+			Action:    a.Action,
+			FirstSeen: now,
+		}
+		if p, ok := prev[key]; ok {
+			c = *p
+		}
+		c.Reason = a.Reason
+		c.LastSeen = now
+		c.Cycles++
+		seenFor := now.Sub(c.FirstSeen)
+		wait := grace
+		if a.Action == onboardAction && settle > wait {
+			wait = settle
+		}
+		c.Qualified = c.Cycles >= confirmations && seenFor >= wait
+		next[key] = &c
+		if c.Qualified {
+			ready = append(ready, a)
+			continue
+		}
+		a.Hold = fmt.Sprintf("seen %d of %d cycles, for %v of %v", c.Cycles, confirmations, seenFor.Round(time.Second), wait)
+		held = append(held, a)
+	}
+	return ready, held
+}
+
+func (t *pendingTracker) list(route string) []PendingCandidate {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	candidates := []PendingCandidate{}
+	for name, cs := range t.routes {
+		if route != "" && route != name {
+			continue
+		}
+		for _, c := range cs {
+			candidates = append(candidates, *c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Route != candidates[j].Route {
+			return candidates[i].Route < candidates[j].Route
+		}
+		return candidates[i].Topic < candidates[j].Topic
+	})
+	return candidates
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func candidateCycles(t *pendingTracker, route string) map[string]int {
+	cycles := make(map[string]int)
+	for _, c := range t.list(route) {
+		cycles[c.Topic] = c.Cycles
+	}
+	return cycles
+}
+
+func TestPendingPreviewDoesNotCount(t *testing.T) {
+	tracker := &pendingTracker{routes: make(map[string]map[string]*PendingCandidate)}
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	actions := []PlanAction{{Action: blacklistAction, Topic: `gone`}}
+	tracker.observe(`atl-atl`, actions, nil, 3, 0, 0, now)
+	for i := 1; i <= 5; i++ {
+		ready, held := tracker.preview(`atl-atl`, actions, 3, 0, 0, now.Add(time.Duration(i)*time.Minute))
+		if len(ready) != 0 || len(held) != 1 {
+			t.Fatalf("preview %d = %d ready, %d held; want the candidate held", i, len(ready), len(held))
+		}
+	}
+	if got := candidateCycles(tracker, `atl-atl`)[`gone`]; got != 1 {
+		t.Errorf("cycles after previews = %d; want 1", got)
+	}
+	tracker.observe(`atl-atl`, actions, nil, 3, 0, 0, now.Add(time.Hour))
+	ready, _ := tracker.observe(`atl-atl`, actions, nil, 3, 0, 0, now.Add(time.Hour*2))
+	if len(ready) != 1 {
+		t.Errorf("candidate did not qualify after 3 observed cycles")
+	}
+}
+
+func TestPendingObserveFiltered(t *testing.T) {
+	tracker := &pendingTracker{routes: make(map[string]map[string]*PendingCandidate)}
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	tracker.observe(`atl-atl`, []PlanAction{{Action: blacklistAction, Topic: `gone`}, {Action: blacklistAction, Topic: `orders`}}, nil, 3, 0, 0, now)
+
+	only := mustPatterns(t, `orders`)
+	tracker.observe(`atl-atl`, []PlanAction{{Action: blacklistAction, Topic: `orders`}}, only, 3, 0, 0, now.Add(time.Minute))
+	cycles := candidateCycles(tracker, `atl-atl`)
+	if cycles[`gone`] != 1 || cycles[`orders`] != 2 {
+		t.Errorf("cycles after a filtered run = %v; want gone 1, orders 2", cycles)
+	}
+
+	tracker.observe(`atl-atl`, nil, only, 3, 0, 0, now.Add(time.Minute*2))
+	cycles = candidateCycles(tracker, `atl-atl`)
+	if _, ok := cycles[`orders`]; ok || cycles[`gone`] != 1 {
+		t.Errorf("cycles after a filtered run without orders = %v; want only gone 1", cycles)
+	}
+
+	tracker.observe(`atl-atl`, nil, nil, 3, 0, 0, now.Add(time.Minute*3))
+	if cycles = candidateCycles(tracker, `atl-atl`); len(cycles) != 0 {
+		t.Errorf("cycles after an unfiltered run = %v; want none", cycles)
+	}
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	reasonMissingBothSides = `replicated but missing from source and destination`
+	reasonMissingSource    = `replicated but missing from source`
+	reasonPresentBothSides = `blacklisted but present in source and destination`
+	reasonMissingDest      = `blacklisted, present in source and missing from destination`
+	reasonNewTopic         = `new source topic matching include pattern %s`
+
+	ruleIgnore  = `ignore`
+	ruleProtect = `protect`
+	rulePolicy  = `deletionpolicy`
+
+	policyBoth          = `both`
+	policySourceMissing = `source-missing`
+	policyNever         = `never`
+)
+
+func (a reconcileAction) String() string {
+	switch a {
+	case blacklistAction:
+		return `blacklist`
+	case whitelistAction:
+		return `whitelist`
+	case expandAction:
+		return `expand`
+	case configAction:
+		return `config`
+	case onboardAction:
+		return `onboard`
+	case createAction:
+		return `create`
+	default:
+		return `both`
+	}
+}
+
+func parseAction(mode string) (reconcileAction, error) {
+	for _, a := range []reconcileAction{bothAction, blacklistAction, whitelistAction} {
+		if mode == a.String() {
+			return a, nil
+		}
+	}
+	return bothAction, fmt.Errorf("invalid mode %q, expected one of both, blacklist or whitelist", mode)
+}
+
+// enumValues returns the names of every action.
+func (a reconcileAction) enumValues() []string {
+	var names []string
+	for v := bothAction; v <= createAction; v++ {
+		names = append(names, v.String())
+	}
+	return names
+}
+
+// MarshalText .
+func (a reconcileAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText .
+func (a *reconcileAction) UnmarshalText(text []byte) error {
+	for v := bothAction; v <= createAction; v++ {
+		if v.String() == string(text) {
+			*a = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", text)
+}
+
+// Snapshot is the state of a route that a Plan is computed from.
+type Snapshot struct {
+	Route         string
+	Taken         time.Time
+	ZKTopics      []string
+	Blacklist     []string
+	SrcTopics     []string
+	DstTopics     []string
+	SrcPartitions map[string]int
+	DstPartitions map[string]int
+	// ReplPartitions is the partition count uReplicator has registered for each replicated topic.
+	ReplPartitions map[string]int
+	// SrcConfigs and DstConfigs hold the compared config values of each replicated topic,
+	// without sensitive keys.
+	SrcConfigs map[string]map[string]string
+	DstConfigs map[string]map[string]string
+	// Owned is the blacklisted topics the route blacklisted itself or adopted.
+	Owned []string
+	// Migrated is the blacklisted topics a migration moved to another route.
+	Migrated []string
+	// Expired is the blacklisted topics blacklisted when their replication lease expired.
+	Expired []string
+	// Leases are the topics whitelisted until a given time.
+	Leases []Lease
+}
+
+// SnapshotCounts summarizes the size of a Snapshot.
+type SnapshotCounts struct {
+	ZKTopics   int `json:"zkTopics"`
+	Blacklist  int `json:"blacklist"`
+	SrcTopics  int `json:"srcTopics"`
+	DstTopics  int `json:"dstTopics"`
+	Replicated int `json:"replicated"`
+}
+
+func (s Snapshot) counts() SnapshotCounts {
+	return SnapshotCounts{
+		ZKTopics:   len(s.ZKTopics),
+		Blacklist:  len(s.Blacklist),
+		SrcTopics:  len(s.SrcTopics),
+		DstTopics:  len(s.DstTopics),
+		Replicated: len(s.replicated()),
+	}
+}
+
+// replicated returns the topics registered with uReplicator that are not blacklisted.
+func (s Snapshot) replicated() []string {
+	blSet := newTopicSet(s.Blacklist...)
+	var topics []string
+	for _, t := range s.ZKTopics {
+		if !blSet.has(t) {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// PlanAction is a single change a Plan makes to a route, with the reason it was chosen.
+type PlanAction struct {
+	Action     reconcileAction   `json:"action"`
+	Topic      string            `json:"topic"`
+	Partitions int               `json:"partitions,omitempty"`
+	Reason     string            `json:"reason"`
+	Hold       string            `json:"hold,omitempty"`
+	Create     bool              `json:"create,omitempty"`
+	Configs    map[string]string `json:"configs,omitempty"`
+	Policy     string            `json:"policy,omitempty"`
+	// Lease marks the blacklist of a topic whose replication lease expired.
+	Lease bool `json:"lease,omitempty"`
+}
+
+// PlanExclusion is an action a route rule kept out of a Plan.
+type PlanExclusion struct {
+	Action  reconcileAction `json:"action"`
+	Topic   string          `json:"topic"`
+	Rule    string          `json:"rule"`
+	Pattern string          `json:"pattern"`
+}
+
+// PartitionDrift is a replicated topic whose partition counts differ between the source,
+// uReplicator and the destination.
+type PartitionDrift struct {
+	Topic       string `json:"topic"`
+	Source      int    `json:"source"`
+	Replicated  int    `json:"replicated"`
+	Destination int    `json:"destination"`
+}
+
+// ConfigDrift is a topic config whose value differs between the source and destination.
+type ConfigDrift struct {
+	Topic       string `json:"topic"`
+	Config      string `json:"config"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// planRules are the route settings that narrow what a Plan may act on.
+type planRules struct {
+	Only    patternList
+	Protect patternList
+	Ignore  patternList
+	// CreateMissing whitelists blacklisted topics missing from the destination, to be created first.
+	CreateMissing bool
+	// FixConfigs sets drifted destination topic configs to their source values.
+	FixConfigs bool
+	// DeletionPolicy decides which missing topics are blacklisted.
+	DeletionPolicy string
+	// WhitelistUnowned whitelists blacklist entries the route does not own as well.
+	WhitelistUnowned bool
+	// Include and Exclude select the new source topics to onboard.
+	Include patternList
+	Exclude patternList
+}
+
+// Plan is the set of actions that reconciles a route.
+type Plan struct {
+	ID       string           `json:"id"`
+	Route    string           `json:"route"`
+	Mode     reconcileAction  `json:"mode"`
+	Created  time.Time        `json:"created"`
+	Snapshot SnapshotCounts   `json:"snapshot"`
+	Actions  []PlanAction     `json:"actions"`
+	Deferred []PlanAction     `json:"deferred,omitempty"`
+	Excluded []PlanExclusion  `json:"excluded,omitempty"`
+	Breaker  string           `json:"breaker,omitempty"`
+	Drift    []PartitionDrift `json:"drift,omitempty"`
+	Configs  []ConfigDrift    `json:"configDrift,omitempty"`
+}
+
+// fingerprint identifies a Plan by its route and actions, so the same changes planned in
+// different cycles share an ID.
+func (p Plan) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", p.Route)
+	for _, a := range p.Actions {
+		fmt.Fprintf(h, "%s\n", a.key())
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// key identifies the change an action makes, regardless of why it was planned.
+func (a PlanAction) key() string {
+	key := fmt.Sprintf("%s %s %d", a.Action, a.Topic, a.Partitions)
+	names := make([]string, 0, len(a.Configs))
+	for k := range a.Configs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		key += fmt.Sprintf(" %s=%s", k, a.Configs[k])
+	}
+	return key
+}
+
+// blastRadius returns why a Plan blacklists too much of a route, or an empty string when it is within limits.
+func blastRadius(p Plan, maxTopics int, maxPercent float64) string {
+	count := len(p.topics(blacklistAction))
+	if count < 1 {
+		return ""
+	}
+	if maxTopics > 0 && count > maxTopics {
+		return fmt.Sprintf("plan blacklists %d topics, limit is %d", count, maxTopics)
+	}
+	if maxPercent > 0 && p.Snapshot.Replicated > 0 {
+		pct := float64(count) * 100 / float64(p.Snapshot.Replicated)
+		if pct > maxPercent {
+			return fmt.Sprintf("plan blacklists %.1f%% of %d replicated topics, limit is %.1f%%", pct, p.Snapshot.Replicated, maxPercent)
+		}
+	}
+	return ""
+}
+
+func (p Plan) topics(action reconcileAction) []string {
+	var topics []string
+	for _, a := range p.Actions {
+		if a.Action == action {
+			topics = append(topics, a.Topic)
+		}
+	}
+	return topics
+}
+
+func (p Plan) reasons(action reconcileAction) []TopicReason {
+	var reasons []TopicReason
+	for _, a := range p.Actions {
+		if a.Action == action {
+			reasons = append(reasons, TopicReason{Topic: a.Topic, Reason: a.Reason})
+		}
+	}
+	return reasons
+}
+
+// planReconcile computes the Plan for a route from a Snapshot. It performs no I/O.
+// Replicated topics that gained source partitions are expanded, new source topics matching
+// rules.Include are onboarded and topics whose lease expired are blacklisted, in every mode.
+// Ignored topics are never acted on and protected topics are never blacklisted. Topics the
+// never deletion policy would blacklist are reported as excluded, as are blacklist entries a
+// migration owns and those the route does not own unless rules.WhitelistUnowned is set.
+// When rules.Only is not empty, only topics matching one of its patterns are planned.
+func planReconcile(snap Snapshot, action reconcileAction, rules planRules) Plan {
+	plan := Plan{
+		Route:    snap.Route,
+		Mode:     action,
+		Created:  time.Now(),
+		Snapshot: snap.counts(),
+		Actions:  []PlanAction{},
+	}
+	switch action {
+	case bothAction:
+		plan.Actions = append(plan.Actions, filterDeletedTopics(snap, rules.DeletionPolicy)...)
+		plan.Actions = append(plan.Actions, filterReAddedTopics(snap, rules.CreateMissing)...)
+	case whitelistAction:
+		plan.Actions = append(plan.Actions, filterReAddedTopics(snap, rules.CreateMissing)...)
+	default:
+		plan.Actions = append(plan.Actions, filterDeletedTopics(snap, rules.DeletionPolicy)...)
+	}
+	plan.Actions = filterExpiredLeases(snap, plan.Actions)
+	plan.Actions = append(plan.Actions, filterExpandedTopics(snap)...)
+	plan.Actions = append(plan.Actions, filterNewTopics(snap, rules)...)
+	plan.Drift = partitionDrift(snap)
+	plan.Configs = configDrift(snap)
+	if rules.FixConfigs {
+		plan.Actions = append(plan.Actions, filterConfigTopics(plan.Configs)...)
+	}
+	plan.Actions, plan.Excluded = filterRuleTopics(rules, plan.Actions)
+	var unowned []PlanExclusion
+	plan.Actions, unowned = filterUnownedTopics(snap, rules.WhitelistUnowned, plan.Actions)
+	plan.Excluded = append(plan.Excluded, unowned...)
+	if len(rules.Only) > 0 {
+		plan.Actions = append([]PlanAction{}, filterArgsTopics(rules.Only, plan.Actions)...)
+	}
+	sort.SliceStable(plan.Actions, func(i, j int) bool {
+		if plan.Actions[i].Action != plan.Actions[j].Action {
+			return plan.Actions[i].Action < plan.Actions[j].Action
+		}
+		return plan.Actions[i].Topic < plan.Actions[j].Topic
+	})
+	return plan
+}
+
+// filterDeletedTopics returns the replicated topics to blacklist under a deletion policy. The
+// both policy requires a topic be missing from source and destination, source-missing only from
+// the source. Under never, topics missing from the source are returned to be reported.
+func filterDeletedTopics(snap Snapshot, policy string) []PlanAction {
+	var removeTopics []PlanAction
+	if len(snap.ZKTopics) < 1 || len(snap.Blacklist) < 1 {
+		return removeTopics
+	}
+	blSet := newTopicSet(snap.Blacklist...)
+	dstSet := newTopicSet(snap.DstTopics...)
+	srcSet := newTopicSet(snap.SrcTopics...)
+	for _, topic := range snap.ZKTopics {
+		if blSet.has(topic) || srcSet.has(topic) {
+			continue
+		}
+		reason := reasonMissingBothSides
+		if dstSet.has(topic) {
+			if policy != policySourceMissing && policy != policyNever {
+				continue
+			}
+			reason = reasonMissingSource
+		}
+		removeTopics = append(removeTopics, PlanAction{
+			Action: blacklistAction,
+			Topic:  topic,
+			Reason: reason,
+			Policy: policy,
+			// The registered partition count lets the blacklist be undone.
+			Partitions: snap.ReplPartitions[topic],
+		})
+	}
+	return removeTopics
+}
+
+func filterReAddedTopics(snap Snapshot, create bool) []PlanAction {
+	var addedTopics []PlanAction
+	if len(snap.Blacklist) < 1 {
+		return addedTopics
+	}
+	dstSet := newTopicSet(snap.DstTopics...)
+	srcSet := newTopicSet(snap.SrcTopics...)
+	for _, topic := range snap.Blacklist {
+		switch {
+		case !srcSet.has(topic):
+		case dstSet.has(topic):
+			addedTopics = append(addedTopics, PlanAction{
+				Action:     whitelistAction,
+				Topic:      topic,
+				Partitions: snap.SrcPartitions[topic],
+				Reason:     reasonPresentBothSides,
+			})
+		case create:
+			addedTopics = append(addedTopics, PlanAction{
+				Action:     whitelistAction,
+				Topic:      topic,
+				Partitions: snap.SrcPartitions[topic],
+				Reason:     reasonMissingDest,
+				Create:     true,
+			})
+		}
+	}
+	return addedTopics
+}
+
+// filterNewTopics returns the source topics matching an include and no exclude pattern that are
+// not registered with uReplicator. Topics missing from the destination are only onboarded when
+// they may be created.
+func filterNewTopics(snap Snapshot, rules planRules) []PlanAction {
+	var newTopics []PlanAction
+	if len(rules.Include) < 1 {
+		return newTopics
+	}
+	known := newTopicSet(append(append([]string{}, snap.ZKTopics...), snap.Blacklist...)...)
+	dstSet := newTopicSet(snap.DstTopics...)
+	for _, topic := range snap.SrcTopics {
+		if known.has(topic) {
+			continue
+		}
+		p, ok := rules.Include.match(topic)
+		if !ok {
+			continue
+		}
+		if _, ok := rules.Exclude.match(topic); ok {
+			continue
+		}
+		create := !dstSet.has(topic)
+		if create && !rules.CreateMissing {
+			continue
+		}
+		newTopics = append(newTopics, PlanAction{
+			Action:     onboardAction,
+			Topic:      topic,
+			Partitions: snap.SrcPartitions[topic],
+			Reason:     fmt.Sprintf(reasonNewTopic, p),
+			Create:     create,
+		})
+	}
+	return newTopics
+}
+
+func filterExpandedTopics(snap Snapshot) []PlanAction {
+	var expandTopics []PlanAction
+	for _, topic := range snap.replicated() {
+		src, srcOK := snap.SrcPartitions[topic]
+		repl, replOK := snap.ReplPartitions[topic]
+		if srcOK && replOK && src > repl {
+			expandTopics = append(expandTopics, PlanAction{
+				Action:     expandAction,
+				Topic:      topic,
+				Partitions: src,
+				Reason:     fmt.Sprintf("source has %d partitions, uReplicator has %d", src, repl),
+			})
+		}
+	}
+	return expandTopics
+}
+
+// partitionDrift returns the replicated topics present on the source whose partition counts
+// are not the same everywhere. A topic missing from uReplicator or the destination counts as 0.
+func partitionDrift(snap Snapshot) []PartitionDrift {
+	var drift []PartitionDrift
+	for _, topic := range snap.replicated() {
+		src, ok := snap.SrcPartitions[topic]
+		if !ok {
+			continue
+		}
+		d := PartitionDrift{
+			Topic:       topic,
+			Source:      src,
+			Replicated:  snap.ReplPartitions[topic],
+			Destination: snap.DstPartitions[topic],
+		}
+		if d.Replicated != src || d.Destination != src {
+			drift = append(drift, d)
+		}
+	}
+	return drift
+}
+
+// configDrift returns every compared config whose source and destination values differ.
+func configDrift(snap Snapshot) []ConfigDrift {
+	var drift []ConfigDrift
+	topics := make([]string, 0, len(snap.SrcConfigs))
+	for t := range snap.SrcConfigs {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		dst, ok := snap.DstConfigs[topic]
+		if !ok {
+			continue
+		}
+		src := snap.SrcConfigs[topic]
+		keys := make([]string, 0, len(src))
+		for k := range src {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d, ok := dst[k]; ok && d != src[k] {
+				drift = append(drift, ConfigDrift{Topic: topic, Config: k, Source: src[k], Destination: d})
+			}
+		}
+	}
+	return drift
+}
+
+func filterConfigTopics(drift []ConfigDrift) []PlanAction {
+	var fixTopics []PlanAction
+	for _, d := range drift {
+		n := len(fixTopics)
+		if n < 1 || fixTopics[n-1].Topic != d.Topic {
+			fixTopics = append(fixTopics, PlanAction{
+				Action:  configAction,
+				Topic:   d.Topic,
+				Configs: make(map[string]string),
+			})
+			n++
+		}
+		a := &fixTopics[n-1]
+		a.Configs[d.Config] = d.Source
+		if a.Reason != "" {
+			a.Reason += `; `
+		}
+		a.Reason += fmt.Sprintf("%s is %s on destination, %s on source", d.Config, d.Destination, d.Source)
+	}
+	return fixTopics
+}
+
+func filterRuleTopics(rules planRules, actions []PlanAction) ([]PlanAction, []PlanExclusion) {
+	filtered := []PlanAction{}
+	var excluded []PlanExclusion
+	for _, a := range actions {
+		if p, ok := rules.Ignore.match(a.Topic); ok {
+			excluded = append(excluded, PlanExclusion{Action: a.Action, Topic: a.Topic, Rule: ruleIgnore, Pattern: p})
+			continue
+		}
+		if a.Action == blacklistAction && a.Policy == policyNever {
+			excluded = append(excluded, PlanExclusion{Action: a.Action, Topic: a.Topic, Rule: rulePolicy, Pattern: a.Policy})
+			continue
+		}
+		if p, ok := rules.Protect.match(a.Topic); ok && a.Action == blacklistAction {
+			excluded = append(excluded, PlanExclusion{Action: a.Action, Topic: a.Topic, Rule: ruleProtect, Pattern: p})
+			continue
+		}
+		filtered = append(filtered, a)
+	}
+	return filtered, excluded
+}
+
+func filterArgsTopics(only patternList, actions []PlanAction) []PlanAction {
+	var filtered []PlanAction
+	for _, a := range actions {
+		if _, ok := only.match(a.Topic); ok {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+func logPlan(plan Plan, execute bool) {
+	L := logger.With(zap.String("Cluster", plan.Route),
+		zap.String("ReconcileAction", plan.Mode.String()),
+		zap.Bool("Perform Execution", execute))
+	for _, e := range plan.Excluded {
+		L.Info("Excluded Action", zap.String("Action", e.Action.String()), zap.String("Topic", e.Topic), zap.String("Rule", e.Rule), zap.String("Pattern", e.Pattern))
+	}
+	for _, d := range plan.Drift {
+		L.Warn("Partition Drift", zap.String("Topic", d.Topic), zap.Int("Source", d.Source), zap.Int("Replicated", d.Replicated), zap.Int("Destination", d.Destination))
+	}
+	for _, d := range plan.Configs {
+		L.Warn("Config Drift", zap.String("Topic", d.Topic), zap.String("Config", d.Config), zap.String("Source", d.Source), zap.String("Destination", d.Destination))
+	}
+	for _, a := range plan.Deferred {
+		L.Info("Deferred Action", zap.String("Action", a.Action.String()), zap.String("Topic", a.Topic), zap.String("Reason", a.Reason), zap.String("Hold", a.Hold))
+	}
+	if len(plan.Actions) < 1 {
+		L.Info("No topics need reconciliation")
+		return
+	}
+	for _, a := range plan.Actions {
+		L.Info("Planned Action", zap.String("Action", a.Action.String()), zap.String("Topic", a.Topic), zap.Int("Partitions", a.Partitions), zap.String("Reason", a.Reason), zap.Bool("Create", a.Create))
+	}
+}
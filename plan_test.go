@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func actionTopics(actions []PlanAction) []string {
+	topics := []string{}
+	for _, a := range actions {
+		topics = append(topics, a.Action.String()+` `+a.Topic)
+	}
+	return topics
+}
+
+func TestFilterDeletedTopicsExact(t *testing.T) {
+	snap := Snapshot{
+		ZKTopics:  []string{`orders.v1`, `ordersXv1`, `metrics[1]`, `a+b`, `a(b`, `x|y`, `events`},
+		Blacklist: []string{`events`},
+		SrcTopics: []string{`ordersXv1`, `metrics1`, `aab`, `x`, `y`},
+		DstTopics: []string{`ordersXv1`},
+	}
+	got := actionTopics(filterDeletedTopics(snap, policyBoth))
+	want := []string{`blacklist orders.v1`, `blacklist metrics[1]`, `blacklist a+b`, `blacklist a(b`, `blacklist x|y`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterDeletedTopics = %q; want %q", got, want)
+	}
+}
+
+func TestFilterReAddedTopicsExact(t *testing.T) {
+	snap := Snapshot{
+		Blacklist: []string{`orders.v1`, `metrics[1]`, `a+b`, `a(b`, `.*`},
+		SrcTopics: []string{`ordersXv1`, `metrics[1]`, `aab`, `a(b`, `anything`},
+		DstTopics: []string{`ordersXv1`, `metrics[1]`, `aab`, `a(b`, `anything`},
+	}
+	got := actionTopics(filterReAddedTopics(snap, false))
+	want := []string{`whitelist metrics[1]`, `whitelist a(b`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterReAddedTopics = %q; want %q", got, want)
+	}
+}
+
+// benchSnapshot is a route of n registered, source and destination topics. Every tenth topic
+// is missing from the source and destination and every twentieth is blacklisted.
+func benchSnapshot(n int) Snapshot {
+	snap := Snapshot{
+		Route:          `bench`,
+		SrcPartitions:  make(map[string]int, n),
+		DstPartitions:  make(map[string]int, n),
+		ReplPartitions: make(map[string]int, n),
+	}
+	for i := 0; i < n; i++ {
+		topic := fmt.Sprintf("team%d.service.events.v%d", i%50, i)
+		snap.ZKTopics = append(snap.ZKTopics, topic)
+		snap.ReplPartitions[topic] = 12
+		if i%20 == 0 {
+			snap.Blacklist = append(snap.Blacklist, topic)
+		}
+		if i%10 == 0 {
+			continue
+		}
+		snap.SrcTopics = append(snap.SrcTopics, topic)
+		snap.DstTopics = append(snap.DstTopics, topic)
+		snap.SrcPartitions[topic] = 12
+		snap.DstPartitions[topic] = 12
+	}
+	return snap
+}
+
+func BenchmarkPlanReconcile(b *testing.B) {
+	snap := benchSnapshot(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		planReconcile(snap, bothAction, planRules{DeletionPolicy: policyBoth, WhitelistUnowned: true})
+	}
+}
+
+func BenchmarkFilterDeletedTopics(b *testing.B) {
+	snap := benchSnapshot(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterDeletedTopics(snap, policyBoth)
+	}
+}
+
+func BenchmarkFilterReAddedTopics(b *testing.B) {
+	snap := benchSnapshot(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterReAddedTopics(snap, false)
+	}
+}
+
+func describeActions(actions []PlanAction) []string {
+	described := []string{}
+	for _, a := range actions {
+		d := a.Action.String() + ` ` + a.Topic
+		if a.Create {
+			d += ` create`
+		}
+		if a.Lease {
+			d += ` lease`
+		}
+		described = append(described, d)
+	}
+	return described
+}
+
+func describeExclusions(excluded []PlanExclusion) []string {
+	described := []string{}
+	for _, x := range excluded {
+		described = append(described, fmt.Sprintf("%v %v %v %v", x.Action, x.Topic, x.Rule, x.Pattern))
+	}
+	return described
+}
+
+func mustPatterns(t *testing.T, patterns ...string) patternList {
+	t.Helper()
+	list, err := compilePatterns(patterns...)
+	if err != nil {
+		t.Fatalf("compile %q: %v", patterns, err)
+	}
+	return list
+}
+
+// testSnapshot is a route where keep is replicated, gone is missing from source and destination,
+// moved is missing from source only, and back, nodest and manual are blacklisted but present in
+// source. The route owns the blacklist entries of back and nodest, manual was blacklisted by hand.
+func testSnapshot() Snapshot {
+	return Snapshot{
+		Route:     `atl-atl`,
+		Taken:     time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		ZKTopics:  []string{`keep`, `gone`, `moved`, `back`, `nodest`, `manual`},
+		Blacklist: []string{`back`, `nodest`, `manual`},
+		SrcTopics: []string{`keep`, `back`, `nodest`, `manual`},
+		DstTopics: []string{`keep`, `moved`, `back`, `manual`},
+		Owned:     []string{`back`, `nodest`},
+	}
+}
+
+func TestPlanReconcile(t *testing.T) {
+	expired := time.Date(2019, 6, 1, 11, 0, 0, 0, time.UTC)
+	running := time.Date(2019, 6, 1, 13, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mode     reconcileAction
+		rules    planRules
+		snap     func(*Snapshot)
+		actions  []string
+		excluded []string
+	}{
+		{
+			name:     `both`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policyBoth},
+			actions:  []string{`blacklist gone`, `whitelist back`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:    `blacklist`,
+			mode:    blacklistAction,
+			rules:   planRules{DeletionPolicy: policyBoth},
+			actions: []string{`blacklist gone`},
+		},
+		{
+			name:     `whitelist`,
+			mode:     whitelistAction,
+			rules:    planRules{DeletionPolicy: policyBoth},
+			actions:  []string{`whitelist back`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:     `only patterns`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policyBoth, Only: mustPatterns(t, `g.*`)},
+			actions:  []string{`blacklist gone`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:     `protect`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policyBoth, Protect: mustPatterns(t, `go.*`, `back`)},
+			actions:  []string{`whitelist back`},
+			excluded: []string{`blacklist gone protect go.*`, `whitelist manual owner operator`},
+		},
+		{
+			name:     `ignore`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policyBoth, Ignore: mustPatterns(t, `back|gone`)},
+			actions:  []string{},
+			excluded: []string{`blacklist gone ignore back|gone`, `whitelist back ignore back|gone`, `whitelist manual owner operator`},
+		},
+		{
+			name:     `source-missing policy`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policySourceMissing},
+			actions:  []string{`blacklist gone`, `blacklist moved`, `whitelist back`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:     `never policy`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policyNever},
+			actions:  []string{`whitelist back`},
+			excluded: []string{`blacklist gone deletionpolicy never`, `blacklist moved deletionpolicy never`, `whitelist manual owner operator`},
+		},
+		{
+			name:    `no blacklist entry`,
+			mode:    bothAction,
+			rules:   planRules{DeletionPolicy: policyBoth},
+			snap:    func(s *Snapshot) { s.Blacklist = nil },
+			actions: []string{},
+		},
+		{
+			name:     `create missing`,
+			mode:     bothAction,
+			rules:    planRules{DeletionPolicy: policyBoth, CreateMissing: true},
+			actions:  []string{`blacklist gone`, `whitelist back`, `whitelist nodest create`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:    `whitelist unowned`,
+			mode:    whitelistAction,
+			rules:   planRules{DeletionPolicy: policyBoth, WhitelistUnowned: true},
+			actions: []string{`whitelist back`, `whitelist manual`},
+		},
+		{
+			name:     `migrated`,
+			mode:     whitelistAction,
+			rules:    planRules{DeletionPolicy: policyBoth},
+			snap:     func(s *Snapshot) { s.Owned, s.Migrated = []string{`nodest`}, []string{`back`} },
+			actions:  []string{},
+			excluded: []string{`whitelist back owner migration`, `whitelist manual owner operator`},
+		},
+		{
+			name:     `migrated whitelist unowned`,
+			mode:     whitelistAction,
+			rules:    planRules{DeletionPolicy: policyBoth, WhitelistUnowned: true},
+			snap:     func(s *Snapshot) { s.Migrated = []string{`manual`} },
+			actions:  []string{`whitelist back`},
+			excluded: []string{`whitelist manual owner migration`},
+		},
+		{
+			name:  `onboard`,
+			mode:  whitelistAction,
+			rules: planRules{DeletionPolicy: policyBoth, Include: mustPatterns(t, `new\..*`), Exclude: mustPatterns(t, `new\.skip`)},
+			snap: func(s *Snapshot) {
+				s.SrcTopics = append(s.SrcTopics, `new.orders`, `new.skip`, `new.nodest`, `other`)
+				s.DstTopics = append(s.DstTopics, `new.orders`, `new.skip`, `other`)
+			},
+			actions:  []string{`whitelist back`, `onboard new.orders`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:  `onboard and create`,
+			mode:  whitelistAction,
+			rules: planRules{DeletionPolicy: policyBoth, Include: mustPatterns(t, `new\..*`), CreateMissing: true},
+			snap: func(s *Snapshot) {
+				s.SrcTopics = append(s.SrcTopics, `new.orders`, `new.nodest`)
+				s.DstTopics = append(s.DstTopics, `new.orders`)
+			},
+			actions:  []string{`whitelist back`, `whitelist nodest create`, `onboard new.nodest create`, `onboard new.orders`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:  `expand`,
+			mode:  blacklistAction,
+			rules: planRules{DeletionPolicy: policyBoth},
+			snap: func(s *Snapshot) {
+				s.SrcPartitions = map[string]int{`keep`: 6}
+				s.ReplPartitions = map[string]int{`keep`: 3}
+			},
+			actions: []string{`blacklist gone`, `expand keep`},
+		},
+		{
+			name:  `expired leases`,
+			mode:  whitelistAction,
+			rules: planRules{DeletionPolicy: policyBoth},
+			snap: func(s *Snapshot) {
+				s.Leases = []Lease{
+					{Route: `atl-atl`, Topic: `keep`, Expires: expired},
+					{Route: `atl-atl`, Topic: `moved`, Expires: running},
+					{Route: `atl-atl`, Topic: `back`, Expires: expired},
+				}
+			},
+			actions:  []string{`blacklist keep lease`, `whitelist back`},
+			excluded: []string{`whitelist manual owner operator`},
+		},
+		{
+			name:  `expired lease already blacklisted`,
+			mode:  blacklistAction,
+			rules: planRules{DeletionPolicy: policyBoth},
+			snap: func(s *Snapshot) {
+				s.Leases = []Lease{{Route: `atl-atl`, Topic: `gone`, Expires: expired}}
+			},
+			actions: []string{`blacklist gone lease`},
+		},
+		{
+			name:  `expired lease whitelist unowned`,
+			mode:  whitelistAction,
+			rules: planRules{DeletionPolicy: policyBoth, WhitelistUnowned: true},
+			snap: func(s *Snapshot) {
+				s.Leases = []Lease{{Route: `atl-atl`, Topic: `manual`, Expires: expired}}
+				s.Expired = []string{`manual`}
+			},
+			actions:  []string{`whitelist back`},
+			excluded: []string{`whitelist manual owner lease`},
+		},
+		{
+			name:  `protected expired lease`,
+			mode:  blacklistAction,
+			rules: planRules{DeletionPolicy: policyBoth, Protect: mustPatterns(t, `keep`)},
+			snap: func(s *Snapshot) {
+				s.Leases = []Lease{{Route: `atl-atl`, Topic: `keep`, Expires: expired}}
+			},
+			actions:  []string{`blacklist gone`},
+			excluded: []string{`blacklist keep protect keep`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap := testSnapshot()
+			if tt.snap != nil {
+				tt.snap(&snap)
+			}
+			plan := planReconcile(snap, tt.mode, tt.rules)
+			if got := describeActions(plan.Actions); !reflect.DeepEqual(got, tt.actions) {
+				t.Errorf("actions = %q; want %q", got, tt.actions)
+			}
+			want := tt.excluded
+			if want == nil {
+				want = []string{}
+			}
+			if got := describeExclusions(plan.Excluded); !reflect.DeepEqual(got, want) {
+				t.Errorf("excluded = %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPlanReconcileDrift(t *testing.T) {
+	snap := testSnapshot()
+	snap.SrcPartitions = map[string]int{`keep`: 6, `back`: 6}
+	snap.ReplPartitions = map[string]int{`keep`: 6}
+	snap.DstPartitions = map[string]int{`keep`: 3}
+	snap.SrcConfigs = map[string]map[string]string{`keep`: {`retention.ms`: `86400000`, `cleanup.policy`: `delete`}}
+	snap.DstConfigs = map[string]map[string]string{`keep`: {`retention.ms`: `3600000`, `cleanup.policy`: `delete`}}
+
+	plan := planReconcile(snap, blacklistAction, planRules{DeletionPolicy: policyBoth})
+	wantDrift := []PartitionDrift{{Topic: `keep`, Source: 6, Replicated: 6, Destination: 3}}
+	if !reflect.DeepEqual(plan.Drift, wantDrift) {
+		t.Errorf("drift = %+v; want %+v", plan.Drift, wantDrift)
+	}
+	wantConfigs := []ConfigDrift{{Topic: `keep`, Config: `retention.ms`, Source: `86400000`, Destination: `3600000`}}
+	if !reflect.DeepEqual(plan.Configs, wantConfigs) {
+		t.Errorf("config drift = %+v; want %+v", plan.Configs, wantConfigs)
+	}
+	if got, want := describeActions(plan.Actions), []string{`blacklist gone`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("actions without fixing configs = %q; want %q", got, want)
+	}
+
+	plan = planReconcile(snap, blacklistAction, planRules{DeletionPolicy: policyBoth, FixConfigs: true})
+	if got, want := describeActions(plan.Actions), []string{`blacklist gone`, `config keep`}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("actions fixing configs = %q; want %q", got, want)
+	}
+	if got, want := plan.Actions[1].Configs, map[string]string{`retention.ms`: `86400000`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("configs = %v; want %v", got, want)
+	}
+}
+
+func TestBlastRadius(t *testing.T) {
+	plan := func(replicated int, blacklist ...string) Plan {
+		p := Plan{Snapshot: SnapshotCounts{Replicated: replicated}}
+		for _, topic := range blacklist {
+			p.Actions = append(p.Actions, PlanAction{Action: blacklistAction, Topic: topic})
+		}
+		p.Actions = append(p.Actions, PlanAction{Action: whitelistAction, Topic: `back`})
+		return p
+	}
+	tests := []struct {
+		name       string
+		plan       Plan
+		maxTopics  int
+		maxPercent float64
+		want       string
+	}{
+		{`no limits`, plan(2, `a`, `b`), 0, 0, ``},
+		{`no blacklist`, plan(2), 1, 1, ``},
+		{`within topic limit`, plan(10, `a`, `b`), 2, 0, ``},
+		{`over topic limit`, plan(10, `a`, `b`, `c`), 2, 0, `plan blacklists 3 topics, limit is 2`},
+		{`within percent limit`, plan(10, `a`, `b`), 0, 20, ``},
+		{`over percent limit`, plan(10, `a`, `b`, `c`), 0, 20, `plan blacklists 30.0% of 10 replicated topics, limit is 20.0%`},
+		{`topic limit first`, plan(10, `a`, `b`, `c`), 2, 20, `plan blacklists 3 topics, limit is 2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blastRadius(tt.plan, tt.maxTopics, tt.maxPercent); got != tt.want {
+				t.Errorf("blastRadius = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const outcomeRollback = `rollback`
+
+// RollbackRequest selects executed actions to undo: every action of a run (Run), optionally
+// narrowed to one action (Topic and Action), or every action in a time window (Since, Until),
+// optionally narrowed to a Route, Topic or Action. Rollbacks themselves are only undone by Run.
+type RollbackRequest struct {
+	Run    string    `json:"run,omitempty"`
+	Route  string    `json:"route,omitempty"`
+	Topic  string    `json:"topic,omitempty"`
+	Action string    `json:"action,omitempty"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	DryRun bool      `json:"dryRun"`
+}
+
+// RollbackStep is an inverse operation applied, or previewed, for an executed action.
+type RollbackStep struct {
+	Run     string        `json:"run"`
+	Route   string        `json:"route"`
+	Undoes  ActionResult  `json:"undoes"`
+	Inverse *InverseOp    `json:"inverse,omitempty"`
+	Result  *ActionResult `json:"result,omitempty"`
+	Skipped string        `json:"skipped,omitempty"`
+}
+
+// RollbackResponse lists the steps of a rollback, newest action first.
+type RollbackResponse struct {
+	DryRun bool           `json:"dryRun"`
+	Steps  []RollbackStep `json:"steps"`
+}
+
+// rollbackSteps finds the executed actions selected by req in the history, newest first. Steps of
+// routes that do not execute or are outside their maintenance windows are skipped.
+func rollbackSteps(config *Config, req RollbackRequest) ([]RollbackStep, error) {
+	if req.Run == "" && req.Since.IsZero() {
+		return nil, fmt.Errorf("a run or a since time is required")
+	}
+	records, err := runHistory.query(historyFilter{Run: req.Run, Route: req.Route, Since: req.Since, Until: req.Until})
+	if err != nil {
+		return nil, err
+	}
+	if req.Run != "" && len(records) < 1 {
+		return nil, fmt.Errorf("run %v not found", req.Run)
+	}
+	now := time.Now()
+	steps := []RollbackStep{}
+	for _, r := range records {
+		if r.Outcome == outcomeRollback && req.Run == "" {
+			continue
+		}
+		for i := len(r.Results) - 1; i >= 0; i-- {
+			res := r.Results[i]
+			switch {
+			case req.Topic != "" && res.Topic != req.Topic:
+				continue
+			case req.Action != "" && res.Action.String() != req.Action:
+				continue
+			case !res.succeeded():
+				continue
+			}
+			step := RollbackStep{Run: r.ID, Route: r.Route, Undoes: res}
+			switch {
+			case res.Inverse == nil:
+				step.Skipped = fmt.Sprintf("%v cannot be undone", res.Action)
+			case res.Inverse.Action == whitelistAction && res.Inverse.Partitions < 1:
+				step.Inverse = res.Inverse
+				step.Skipped = `partition count unknown`
+			default:
+				step.Inverse = res.Inverse
+			}
+			if step.Skipped == "" {
+				if C, ok := config.Clusters[r.Route]; !ok {
+					step.Skipped = fmt.Sprintf("route %v is no longer configured", r.Route)
+				} else if err := C.checkExecute(r.Route, now); err != nil {
+					step.Skipped = err.Error()
+				}
+			}
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// rollback applies the inverse of every step not skipped and records the results as rollback
+// runs, one per route. Scheduled reconciles may plan the undone actions again, so routes are
+// best paused, or the topics ignored, first.
+func rollback(config *Config, steps []RollbackStep, identity string) []RollbackStep {
+	var routes []string
+	byRoute := make(map[string][]int)
+	for i, s := range steps {
+		if s.Skipped != "" {
+			continue
+		}
+		if _, ok := byRoute[s.Route]; !ok {
+			routes = append(routes, s.Route)
+		}
+		byRoute[s.Route] = append(byRoute[s.Route], i)
+	}
+	for _, route := range routes {
+		C := config.Clusters[route]
+		start := time.Now()
+		results := rollbackRoute(C, route, steps, byRoute[route])
+		leader, term := currentTerm()
+		run := RunRecord{
+			ID:       fmt.Sprintf("%s-%s-%d", outcomeRollback, route, start.UnixNano()),
+			Route:    route,
+			Leader:   leader,
+			Term:     term,
+			Start:    start,
+			End:      time.Now(),
+			Outcome:  outcomeRollback,
+			Executed: true,
+			Results:  results,
+		}
+		for _, r := range results {
+			if r.Error != "" {
+				run.Errors = append(run.Errors, fmt.Sprintf("%v %v: %v", r.Action, r.Topic, r.Error))
+			}
+		}
+		runHistory.record(run)
+		logger.Info("Rolled back actions", zap.String("Cluster", route), zap.String("Identity", identity), zap.Int("Count", len(results)), zap.Int("Errors", len(run.Errors)))
+	}
+	return steps
+}
+
+// rollbackRoute applies the inverse operations of the given steps to a route, setting each step's Result.
+func rollbackRoute(C Cluster, route string, steps []RollbackStep, idx []int) []ActionResult {
+	ctx, cancel := context.WithTimeout(context.Background(), C.Timeout)
+	defer cancel()
+	client := &http.Client{}
+	var rc *routeClient
+	defer func() {
+		if rc != nil {
+			rc.close()
+		}
+	}()
+	var results []ActionResult
+	for _, i := range idx {
+		s := &steps[i]
+		var res ActionResult
+		switch s.Inverse.Action {
+		case blacklistAction:
+			res = deleteRequest(ctx, client, route, s.Inverse.Topic, C.ReplAPI+apiTopicPath+`/`+s.Inverse.Topic)
+			res.Partitions = s.Undoes.Partitions
+			res.setInverse(nil)
+		case whitelistAction:
+			res = reAddRequest(ctx, client, route, C.ReplAPI+apiTopicPath, s.Inverse.Topic, s.Inverse.Partitions)
+			res.setInverse(nil)
+		case configAction:
+			if rc == nil {
+				rc = newRouteClient(route)
+				if err := rc.launchKafka(C.SourceBroker, C.BrokerAddress); err != nil {
+					res = ActionResult{Action: configAction, Topic: s.Inverse.Topic, Time: time.Now(), Error: err.Error()}
+					rc = nil
+					break
+				}
+			}
+			res = rc.alterConfig(route, s.Inverse.Topic, s.Inverse.Configs)
+			res.setInverse(s.Undoes.Configs)
+		}
+		s.Result = &res
+		results = append(results, res)
+	}
+	return results
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jbvmio/kafka"
+	"github.com/jbvmio/zk"
+)
+
+// routeClient holds the connections and uReplicator target used by a single reconcile of a route.
+type routeClient struct {
+	name      string
+	src       *kafka.KClient
+	dst       *kafka.KClient
+	zk        *zk.ZooKeeper
+	zkServers []string
+	target    string
+
+	// mu guards src and dst, which closeOnDone may close while they are being opened.
+	mu        sync.Mutex
+	closed    bool
+	closeOnce sync.Once
+}
+
+func newRouteClient(name string) *routeClient {
+	return &routeClient{name: name}
+}
+
+// closeOnDone closes the route's clients when ctx is done, failing any call still blocked on them.
+// The returned func stops watching.
+func (rc *routeClient) closeOnDone(ctx context.Context) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// connect connects to the route's Kafka clusters and ZooKeeper and finds its uReplicator target.
+func (rc *routeClient) connect(C Cluster) error {
+	if err := rc.launchKafka(C.SourceBroker, C.BrokerAddress); err != nil {
+		return err
+	}
+	if err := rc.launchZKClient(C.ZKAddress); err != nil {
+		return err
+	}
+	return rc.getZKTarget(C.ZKRoot, rc.name)
+}
+
+func (rc *routeClient) close() {
+	rc.closeOnce.Do(func() {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		rc.closed = true
+		if rc.src != nil {
+			rc.src.Close()
+		}
+		if rc.dst != nil {
+			rc.dst.Close()
+		}
+	})
+}
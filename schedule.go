@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// scheduleSlack lets a route run on the tick closest to its interval rather than one tick late.
+const scheduleSlack = time.Second * 5
+
+// RouteSettings are the effective settings of a route after applying its overrides.
+type RouteSettings struct {
+	Route    string          `json:"route"`
+	Interval string          `json:"interval"`
+	Timeout  string          `json:"timeout"`
+	Execute  bool            `json:"execute"`
+	Mode     reconcileAction `json:"mode"`
+	Windows  []string        `json:"windows"`
+	Timezone string          `json:"timezone,omitempty"`
+	InWindow bool            `json:"inWindow"`
+	// NextWindow is the window open now, or the next to open. It is unset when the route has no windows.
+	NextWindow *WindowPeriod `json:"nextWindow,omitempty"`
+	Approval   bool          `json:"approval"`
+	LastRun    time.Time     `json:"lastRun"`
+	NextRun    time.Time     `json:"nextRun"`
+	Overrides  []string      `json:"overrides"`
+}
+
+type scheduleStore struct {
+	last map[string]time.Time
+	mu   sync.RWMutex
+}
+
+var routeSchedule = &scheduleStore{
+	last: make(map[string]time.Time),
+}
+
+// due reports whether a route's interval has passed since it was last scheduled, and if so
+// records now as its last scheduled run.
+func (s *scheduleStore) due(route string, interval time.Duration, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.last[route]
+	if ok && now.Add(scheduleSlack).Sub(last) < interval {
+		return false
+	}
+	s.last[route] = now
+	return true
+}
+
+func (s *scheduleStore) lastRun(route string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last[route]
+}
+
+// scheduleTick returns how often routes are checked for being due: the shortest route interval.
+func scheduleTick(config *Config) time.Duration {
+	tick := config.Monitor.Reconcile
+	for _, C := range config.Clusters {
+		if C.Reconcile > 0 && C.Reconcile < tick {
+			tick = C.Reconcile
+		}
+	}
+	return tick
+}
+
+func routeSettings(name string, C Cluster, now time.Time) RouteSettings {
+	settings := RouteSettings{
+		Route:     name,
+		Interval:  C.Reconcile.String(),
+		Timeout:   C.Timeout.String(),
+		Execute:   C.Execute,
+		Mode:      C.Mode,
+		Windows:   append([]string{}, C.Windows...),
+		Timezone:  C.Timezone,
+		InWindow:  C.windows.open(now),
+		Approval:  C.Approval,
+		LastRun:   routeSchedule.lastRun(name),
+		Overrides: append([]string{}, C.overrides...),
+	}
+	if period, ok := C.windows.next(now); ok {
+		settings.NextWindow = &period
+	}
+	if !settings.LastRun.IsZero() {
+		settings.NextRun = settings.LastRun.Add(C.Reconcile)
+	}
+	return settings
+}
+
+func listRouteSettings(config *Config, now time.Time) []RouteSettings {
+	settings := make([]RouteSettings, 0, len(config.Clusters))
+	for name, C := range config.Clusters {
+		settings = append(settings, routeSettings(name, C, now))
+	}
+	sort.SliceStable(settings, func(i, j int) bool { return settings[i].Route < settings[j].Route })
+	return settings
+}
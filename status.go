@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	outcomeOK      = `ok`
+	outcomeError   = `error`
+	outcomeInvalid = `invalid`
+	outcomeHeld    = `held`
+	// outcomeDeferred is a route planned outside its maintenance windows, executed in the next one.
+	outcomeDeferred = `deferred`
+)
+
+// RouteStatus is the outcome of the most recent reconcile of a route.
+type RouteStatus struct {
+	Name      string        `json:"name"`
+	LastRun   time.Time     `json:"lastRun"`
+	Duration  string        `json:"duration"`
+	Outcome   string        `json:"outcome"`
+	Error     string        `json:"error,omitempty"`
+	Executed  bool          `json:"executed"`
+	Deferred  string        `json:"deferred,omitempty"`
+	Blacklist []TopicReason `json:"blacklist"`
+	Whitelist []TopicReason `json:"whitelist"`
+	Expand    []TopicReason `json:"expand"`
+	Config    []TopicReason `json:"config"`
+	Onboard   []TopicReason `json:"onboard"`
+	Plan      *Plan         `json:"plan,omitempty"`
+}
+
+// TopicReason .
+type TopicReason struct {
+	Topic  string `json:"topic"`
+	Reason string `json:"reason"`
+}
+
+type routeStatusStore struct {
+	routes map[string]RouteStatus
+	mu     sync.RWMutex
+}
+
+var routeStatuses = &routeStatusStore{
+	routes: make(map[string]RouteStatus),
+}
+
+func (s *routeStatusStore) set(status RouteStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[status.Name] = status
+}
+
+// list returns the status of every configured route, including routes not yet reconciled.
+func (s *routeStatusStore) list(config *Config) []RouteStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]RouteStatus, 0, len(config.Clusters))
+	for name := range config.Clusters {
+		status, ok := s.routes[name]
+		if !ok {
+			status = RouteStatus{Name: name}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (s *routeStatusStore) get(name string) (RouteStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status, ok := s.routes[name]
+	return status, ok
+}
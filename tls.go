@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// peerIdleTimeout is how long an idle peer connection is kept open.
+const peerIdleTimeout = time.Second * 90
+
+var apiTLS *tlsReloader
+
+// tlsReloader holds the certificate material for the API listener and the peer client,
+// reloading it whenever the files on disk change.
+type tlsReloader struct {
+	conf      TLSConfig
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	peerCAs   *x509.CertPool
+	client    *http.Client
+	modTimes  map[string]time.Time
+	mu        sync.RWMutex
+}
+
+func newTLSReloader(conf TLSConfig) (*tlsReloader, error) {
+	r := &tlsReloader{
+		conf:     conf,
+		modTimes: make(map[string]time.Time),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *tlsReloader) files() []string {
+	return []string{r.conf.CertFile, r.conf.KeyFile, r.conf.ClientCA, r.conf.PeerCA}
+}
+
+// load reads the certificate material and replaces the peer client, closing the idle
+// connections of the previous one so they do not pile up across reloads.
+func (r *tlsReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate: %v", err)
+	}
+	clientCAs, err := loadCertPool(r.conf.ClientCA)
+	if err != nil {
+		return fmt.Errorf("unable to load client CA: %v", err)
+	}
+	peerCAs, err := loadCertPool(r.conf.PeerCA)
+	if err != nil {
+		return fmt.Errorf("unable to load peer CA: %v", err)
+	}
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		if fi, err := os.Stat(f); err == nil {
+			modTimes[f] = fi.ModTime()
+		}
+	}
+	r.mu.Lock()
+	prev := r.client
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.peerCAs = peerCAs
+	r.modTimes = modTimes
+	r.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion:           tls.VersionTLS12,
+				RootCAs:              peerCAs,
+				GetClientCertificate: r.getClientCertificate,
+			},
+			IdleConnTimeout: peerIdleTimeout,
+		},
+	}
+	r.mu.Unlock()
+	// Connections still in use are closed by the idle timeout once their request is done.
+	if prev != nil {
+		prev.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	return nil
+}
+
+func (r *tlsReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if !fi.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the configured files and reloads them on change. Failed reloads keep the previous material.
+func (r *tlsReloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if !r.changed() {
+			continue
+		}
+		if err := r.load(); err != nil {
+			logger.Error("Error reloading TLS certificates, keeping previous", zap.Error(err))
+			continue
+		}
+		logger.Info("Reloaded TLS certificates", zap.String("CertFile", r.conf.CertFile))
+	}
+}
+
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCAs,
+				ClientAuth:   tls.VerifyClientCertIfGiven,
+			}, nil
+		},
+	}
+}
+
+func (r *tlsReloader) peerClient() *http.Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.client
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", filename)
+	}
+	return pool, nil
+}
+
+// peerClient returns the client used for peer notifications. Peers are dialed by their member
+// IP address, which their certificates must carry as an IP SAN.
+func peerClient() *http.Client {
+	if apiTLS != nil {
+		return apiTLS.peerClient()
+	}
+	return http.DefaultClient
+}
+
+func apiScheme() string {
+	if apiTLS != nil {
+		return `https`
+	}
+	return `http`
+}
+
+// requirePeerCert only allows requests presenting a client certificate verified against the client CA.
+func requirePeerCert(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiTLS != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) < 1) {
+			logger.Warn("Rejected peer request without a verified client certificate", zap.String("Remote", r.RemoteAddr), zap.String("Path", r.URL.Path))
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "%v", "client certificate required")
+			return
+		}
+		next(w, r)
+	}
+}
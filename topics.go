@@ -0,0 +1,17 @@
+package main
+
+// topicSet is a set of exact topic names.
+type topicSet map[string]struct{}
+
+func newTopicSet(topics ...string) topicSet {
+	set := make(topicSet, len(topics))
+	for _, t := range topics {
+		set[t] = struct{}{}
+	}
+	return set
+}
+
+func (s topicSet) has(topic string) bool {
+	_, ok := s[topic]
+	return ok
+}
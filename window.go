@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowHorizon bounds the search for the next opening of a maintenance window.
+const windowHorizon = 5
+
+var weekdays = map[string]time.Weekday{
+	`sun`: time.Sunday,
+	`mon`: time.Monday,
+	`tue`: time.Tuesday,
+	`wed`: time.Wednesday,
+	`thu`: time.Thursday,
+	`fri`: time.Friday,
+	`sat`: time.Saturday,
+}
+
+var months = map[string]int{
+	`jan`: 1, `feb`: 2, `mar`: 3, `apr`: 4, `may`: 5, `jun`: 6,
+	`jul`: 7, `aug`: 8, `sep`: 9, `oct`: 10, `nov`: 11, `dec`: 12,
+}
+
+// WindowPeriod is a single opening of a maintenance window.
+type WindowPeriod struct {
+	Window string    `json:"window"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// maintenanceWindow is a period during which a route may execute. It opens at every minute
+// matching its cron fields, in its location, and stays open for length.
+type maintenanceWindow struct {
+	raw     string
+	loc     *time.Location
+	minutes [60]bool
+	hours   [24]bool
+	doms    [32]bool
+	months  [13]bool
+	dows    [7]bool
+	anyDOM  bool
+	anyDOW  bool
+	length  time.Duration
+}
+
+// windowList is a set of maintenance windows. An empty list allows execution at any time.
+type windowList []maintenanceWindow
+
+// parseWindows parses windows in loc, the local time zone when nil. A window is either of the
+// form "[days ]HH:MM-HH:MM", where days is a comma separated list of weekdays or weekday ranges
+// such as "mon-fri,sun" and a range ending before it starts runs past midnight, or a cron
+// expression followed by how long the window stays open, such as "0 10 * * mon-fri 6h".
+func parseWindows(loc *time.Location, windows ...string) (windowList, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	list := make(windowList, 0, len(windows))
+	for _, raw := range windows {
+		w := maintenanceWindow{raw: raw, loc: loc}
+		var err error
+		fields := strings.Fields(raw)
+		switch len(fields) {
+		case 1:
+			err = w.parseRange(`*`, fields[0])
+		case 2:
+			err = w.parseRange(fields[0], fields[1])
+		case 6:
+			err = w.parseCron(fields[:5], fields[5])
+		default:
+			err = fmt.Errorf("expected [days ]HH:MM-HH:MM or a cron expression and a duration")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %v", raw, err)
+		}
+		list = append(list, w)
+	}
+	return list, nil
+}
+
+func (w *maintenanceWindow) parseRange(days, hours string) error {
+	if err := w.parseDays(days); err != nil {
+		return err
+	}
+	bounds := strings.Split(hours, `-`)
+	if len(bounds) != 2 {
+		return fmt.Errorf("expected HH:MM-HH:MM")
+	}
+	start, err := parseClock(bounds[0])
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(bounds[1])
+	if err != nil {
+		return err
+	}
+	if start == 24*60 {
+		return fmt.Errorf("invalid start time %q", bounds[0])
+	}
+	w.minutes[start%60] = true
+	w.hours[start/60] = true
+	for i := range w.doms {
+		w.doms[i] = true
+	}
+	for i := range w.months {
+		w.months[i] = true
+	}
+	w.anyDOM = true
+	if end < start {
+		end += 24 * 60
+	}
+	w.length = time.Duration(end-start) * time.Minute
+	return nil
+}
+
+func (w *maintenanceWindow) parseDays(days string) error {
+	if days == `*` {
+		for i := range w.dows {
+			w.dows[i] = true
+		}
+		w.anyDOW = true
+		return nil
+	}
+	for _, part := range strings.Split(strings.ToLower(days), `,`) {
+		bounds := strings.Split(part, `-`)
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return fmt.Errorf("unknown weekday %q", bounds[1])
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.dows[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseCron parses the minute, hour, day of month, month and day of week fields of a cron
+// expression. Like cron, a day matches either day field when both are restricted.
+func (w *maintenanceWindow) parseCron(fields []string, length string) error {
+	var err error
+	if _, err = parseCronField(fields[0], w.minutes[:], 0, 59, nil); err != nil {
+		return fmt.Errorf("minute: %v", err)
+	}
+	if _, err = parseCronField(fields[1], w.hours[:], 0, 23, nil); err != nil {
+		return fmt.Errorf("hour: %v", err)
+	}
+	if w.anyDOM, err = parseCronField(fields[2], w.doms[:], 1, 31, nil); err != nil {
+		return fmt.Errorf("day of month: %v", err)
+	}
+	if _, err = parseCronField(fields[3], w.months[:], 1, 12, months); err != nil {
+		return fmt.Errorf("month: %v", err)
+	}
+	dowNames := make(map[string]int, len(weekdays))
+	for name, d := range weekdays {
+		dowNames[name] = int(d)
+	}
+	var dows [8]bool
+	if w.anyDOW, err = parseCronField(fields[4], dows[:], 0, 7, dowNames); err != nil {
+		return fmt.Errorf("day of week: %v", err)
+	}
+	copy(w.dows[:], dows[:7])
+	w.dows[0] = w.dows[0] || dows[7]
+	if w.length, err = time.ParseDuration(length); err != nil {
+		return err
+	}
+	if w.length < time.Minute {
+		return fmt.Errorf("window must stay open for at least a minute")
+	}
+	return nil
+}
+
+// parseCronField sets the values of a comma separated list of "*", values, "a-b" ranges and
+// "/n" steps in set, reporting whether the field is a plain "*".
+func parseCronField(field string, set []bool, min, max int, names map[string]int) (bool, error) {
+	value := func(s string) (int, error) {
+		if v, ok := names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < min || v > max {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		return v, nil
+	}
+	for _, part := range strings.Split(field, `,`) {
+		step := 1
+		if i := strings.Index(part, `/`); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return false, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+		first, last := min, max
+		if part != `*` {
+			bounds := strings.Split(part, `-`)
+			var err error
+			if first, err = value(bounds[0]); err != nil {
+				return false, err
+			}
+			last = first
+			switch {
+			case len(bounds) == 2:
+				if last, err = value(bounds[1]); err != nil {
+					return false, err
+				}
+			case len(bounds) > 2:
+				return false, fmt.Errorf("invalid range %q", part)
+			case step > 1:
+				last = max
+			}
+			if last < first {
+				return false, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		for v := first; v <= last; v += step {
+			set[v] = true
+		}
+	}
+	return field == `*`, nil
+}
+
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, `:`)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	return h*60 + m, nil
+}
+
+func (w maintenanceWindow) dayMatches(t time.Time) bool {
+	switch {
+	case w.anyDOM:
+		return w.dows[t.Weekday()]
+	case w.anyDOW:
+		return w.doms[t.Day()]
+	default:
+		return w.doms[t.Day()] || w.dows[t.Weekday()]
+	}
+}
+
+// opens reports whether the window opens at t, a time in its location.
+func (w maintenanceWindow) opens(t time.Time) bool {
+	return w.minutes[t.Minute()] && w.hours[t.Hour()] && w.months[t.Month()] && w.dayMatches(t)
+}
+
+// current returns the start of the opening of the window containing t.
+func (w maintenanceWindow) current(t time.Time) (time.Time, bool) {
+	t = t.In(w.loc)
+	for s := t.Truncate(time.Minute); t.Sub(s) < w.length; s = s.Add(-time.Minute) {
+		if w.opens(s) {
+			return s, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w maintenanceWindow) contains(t time.Time) bool {
+	_, ok := w.current(t)
+	return ok
+}
+
+// next returns the first time at or after t the window opens. Hours are stepped in absolute
+// time, as wall clock arithmetic stalls on daylight saving changes, so a window opening at a
+// time skipped by a change does not open that day and one opening in a repeated hour opens twice.
+func (w maintenanceWindow) next(t time.Time) (time.Time, bool) {
+	if w.length <= 0 {
+		return time.Time{}, false
+	}
+	t = t.In(w.loc)
+	s := t.Truncate(time.Minute)
+	if s.Before(t) {
+		s = s.Add(time.Minute)
+	}
+	limit := s.AddDate(windowHorizon, 0, 0)
+	for s.Before(limit) {
+		var n time.Time
+		switch {
+		case !w.months[s.Month()]:
+			n = time.Date(s.Year(), s.Month()+1, 1, 0, 0, 0, 0, w.loc)
+		case !w.dayMatches(s):
+			n = time.Date(s.Year(), s.Month(), s.Day()+1, 0, 0, 0, 0, w.loc)
+		case !w.hours[s.Hour()]:
+			n = s.Add(time.Duration(60-s.Minute()) * time.Minute)
+		case !w.minutes[s.Minute()]:
+			n = s.Add(time.Minute)
+		default:
+			return s, true
+		}
+		if !n.After(s) {
+			n = s.Add(time.Minute)
+		}
+		s = n
+	}
+	return time.Time{}, false
+}
+
+// open reports whether t falls in any window of the list.
+func (l windowList) open(t time.Time) bool {
+	if len(l) < 1 {
+		return true
+	}
+	for _, w := range l {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// deferral describes why execution is deferred at t, empty when a window of the list is open.
+func (l windowList) deferral(t time.Time) string {
+	if l.open(t) {
+		return ""
+	}
+	if period, ok := l.next(t); ok {
+		return fmt.Sprintf("outside maintenance windows, next window %v opens at %v", period.Window, period.Start.Format(time.RFC3339))
+	}
+	return `outside maintenance windows`
+}
+
+// next returns the window period containing t, or the next to open after it. There is none
+// when the list is empty, as execution is never restricted.
+func (l windowList) next(t time.Time) (WindowPeriod, bool) {
+	var period WindowPeriod
+	var found bool
+	for _, w := range l {
+		start, ok := w.current(t)
+		if !ok {
+			start, ok = w.next(t)
+		}
+		if ok && (!found || start.Before(period.Start)) {
+			period = WindowPeriod{Window: w.raw, Start: start, End: start.Add(w.length)}
+			found = true
+		}
+	}
+	return period, found
+}
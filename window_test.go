@@ -0,0 +1,291 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load location %v: %v", name, err)
+	}
+	return loc
+}
+
+func mustWindows(t *testing.T, loc *time.Location, windows ...string) windowList {
+	t.Helper()
+	list, err := parseWindows(loc, windows...)
+	if err != nil {
+		t.Fatalf("parse %q: %v", windows, err)
+	}
+	return list
+}
+
+// nextWithin calls next with a deadline, so a stalled search fails the test instead of hanging it.
+func nextWithin(t *testing.T, w maintenanceWindow, from time.Time) (time.Time, bool) {
+	t.Helper()
+	type result struct {
+		at time.Time
+		ok bool
+	}
+	done := make(chan result, 1)
+	go func() {
+		at, ok := w.next(from)
+		done <- result{at, ok}
+	}()
+	select {
+	case r := <-done:
+		return r.at, r.ok
+	case <-time.After(5 * time.Second):
+		t.Fatalf("next(%v) of %q did not return", from, w.raw)
+		return time.Time{}, false
+	}
+}
+
+func TestWindowNext(t *testing.T) {
+	ny := mustLocation(t, `America/New_York`)
+	kolkata := mustLocation(t, `Asia/Kolkata`)
+	tests := []struct {
+		name   string
+		loc    *time.Location
+		window string
+		from   time.Time
+		want   time.Time
+	}{
+		{
+			name:   `spring forward day`,
+			loc:    ny,
+			window: `10:00-16:00`,
+			from:   time.Date(2027, 3, 13, 17, 0, 0, 0, ny),
+			want:   time.Date(2027, 3, 14, 10, 0, 0, 0, ny),
+		},
+		{
+			name:   `opening skipped by spring forward`,
+			loc:    ny,
+			window: `02:30-03:30`,
+			from:   time.Date(2027, 3, 14, 0, 0, 0, 0, ny),
+			want:   time.Date(2027, 3, 15, 2, 30, 0, 0, ny),
+		},
+		{
+			name:   `first opening in repeated hour`,
+			loc:    ny,
+			window: `01:30-01:45`,
+			from:   time.Date(2027, 11, 7, 0, 0, 0, 0, ny),
+			want:   time.Date(2027, 11, 7, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			name:   `second opening in repeated hour`,
+			loc:    ny,
+			window: `01:30-01:45`,
+			from:   time.Date(2027, 11, 7, 5, 40, 0, 0, time.UTC),
+			want:   time.Date(2027, 11, 7, 6, 30, 0, 0, time.UTC),
+		},
+		{
+			name:   `half hour offset zone`,
+			loc:    kolkata,
+			window: `0 11 * * * 1h`,
+			from:   time.Date(2027, 1, 4, 10, 17, 0, 0, kolkata),
+			want:   time.Date(2027, 1, 4, 11, 0, 0, 0, kolkata),
+		},
+		{
+			name:   `weekday range across the week`,
+			window: `fri-mon 22:00-02:00`,
+			from:   time.Date(2027, 1, 5, 12, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 8, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `from inside an opening`,
+			window: `mon-fri 09:00-17:00`,
+			from:   time.Date(2027, 1, 4, 12, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 5, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `at an opening`,
+			window: `mon-fri 09:00-17:00`,
+			from:   time.Date(2027, 1, 4, 9, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron day of month or day of week`,
+			window: `0 9 1,15 * mon 2h`,
+			from:   time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron day of month before day of week`,
+			window: `0 9 1,15 * mon 2h`,
+			from:   time.Date(2027, 1, 11, 10, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 15, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron day of month only`,
+			window: `0 9 1 * * 1h`,
+			from:   time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 2, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron day of week only`,
+			window: `0 9 * * sun 1h`,
+			from:   time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 3, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron sunday as 7`,
+			window: `0 9 * * 7 1h`,
+			from:   time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 1, 3, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron month names`,
+			window: `0 0 1 jan,jul * 1h`,
+			from:   time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2027, 7, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   `cron steps`,
+			window: `*/15 * * * * 5m`,
+			from:   time.Date(2027, 1, 1, 10, 16, 30, 0, time.UTC),
+			want:   time.Date(2027, 1, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:   `leap day`,
+			window: `0 0 29 2 * 1h`,
+			from:   time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			want:   time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			w := mustWindows(t, loc, tt.window)[0]
+			got, ok := nextWithin(t, w, tt.from)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("next(%v) = %v, %v; want %v", tt.from, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowNextNeverOpens(t *testing.T) {
+	w := mustWindows(t, time.UTC, `0 0 31 2 * 1h`)[0]
+	if got, ok := nextWithin(t, w, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("next = %v; want none", got)
+	}
+}
+
+// TestWindowNextDaily steps through every day of a year with daylight saving changes, so a
+// search stalling on any transition fails.
+func TestWindowNextDaily(t *testing.T) {
+	for _, name := range []string{`America/New_York`, `Europe/London`, `Australia/Lord_Howe`, `America/Santiago`} {
+		loc := mustLocation(t, name)
+		w := mustWindows(t, loc, `10:00-16:00`)[0]
+		for from := time.Date(2027, 1, 1, 17, 0, 0, 0, loc); from.Year() == 2027; from = from.AddDate(0, 0, 1) {
+			got, ok := nextWithin(t, w, from)
+			if !ok || !got.After(from) || got.Sub(from) > 48*time.Hour {
+				t.Fatalf("%v: next(%v) = %v, %v", name, from, got, ok)
+			}
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	ny := mustLocation(t, `America/New_York`)
+	tokyo := mustLocation(t, `Asia/Tokyo`)
+	tests := []struct {
+		name   string
+		loc    *time.Location
+		window string
+		at     time.Time
+		want   bool
+	}{
+		{`past midnight from monday`, time.UTC, `fri-mon 22:00-02:00`, time.Date(2027, 1, 5, 1, 0, 0, 0, time.UTC), true},
+		{`tuesday night`, time.UTC, `fri-mon 22:00-02:00`, time.Date(2027, 1, 5, 23, 0, 0, 0, time.UTC), false},
+		{`past midnight from tuesday`, time.UTC, `fri-mon 22:00-02:00`, time.Date(2027, 1, 6, 1, 0, 0, 0, time.UTC), false},
+		{`saturday night`, time.UTC, `fri-mon 22:00-02:00`, time.Date(2027, 1, 2, 23, 0, 0, 0, time.UTC), true},
+		{`end is exclusive`, time.UTC, `09:00-17:00`, time.Date(2027, 1, 4, 17, 0, 0, 0, time.UTC), false},
+		{`start is inclusive`, time.UTC, `09:00-17:00`, time.Date(2027, 1, 4, 9, 0, 0, 0, time.UTC), true},
+		{`until midnight`, time.UTC, `22:00-24:00`, time.Date(2027, 1, 4, 23, 59, 0, 0, time.UTC), true},
+		{`other time zone`, tokyo, `10:00-11:00`, time.Date(2027, 1, 4, 1, 30, 0, 0, time.UTC), true},
+		{`second pass of repeated hour`, ny, `01:30-01:45`, time.Date(2027, 11, 7, 6, 35, 0, 0, time.UTC), true},
+		{`spans spring forward`, ny, `01:00-04:00`, time.Date(2027, 3, 14, 3, 30, 0, 0, ny), true},
+		{`cron day of week`, time.UTC, `0 9 * * mon-fri 8h`, time.Date(2027, 1, 2, 10, 0, 0, 0, time.UTC), false},
+		{`cron past midnight`, time.UTC, `0 22 * * fri 6h`, time.Date(2027, 1, 2, 3, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := mustWindows(t, tt.loc, tt.window)
+			if got := list.open(tt.at); got != tt.want {
+				t.Errorf("open(%v) = %v; want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowListNext(t *testing.T) {
+	list := mustWindows(t, time.UTC, `sat 09:00-10:00`, `0 12 * * * 1h`)
+	from := time.Date(2027, 1, 2, 9, 30, 0, 0, time.UTC)
+	got, ok := list.next(from)
+	want := WindowPeriod{Window: `sat 09:00-10:00`, Start: time.Date(2027, 1, 2, 9, 0, 0, 0, time.UTC), End: time.Date(2027, 1, 2, 10, 0, 0, 0, time.UTC)}
+	if !ok || got != want {
+		t.Errorf("next(%v) = %+v, %v; want %+v", from, got, ok, want)
+	}
+	if _, ok := windowList(nil).next(from); ok {
+		t.Errorf("empty list has a next window")
+	}
+	if !windowList(nil).open(from) {
+		t.Errorf("empty list is closed")
+	}
+}
+
+func TestCheckExecute(t *testing.T) {
+	windows := mustWindows(t, time.UTC, `sat 09:00-10:00`)
+	open := time.Date(2027, 1, 2, 9, 30, 0, 0, time.UTC)
+	closed := time.Date(2027, 1, 2, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		C    Cluster
+		now  time.Time
+		want string
+	}{
+		{name: `no windows`, C: Cluster{Execute: true}, now: closed},
+		{name: `open window`, C: Cluster{Execute: true, windows: windows}, now: open},
+		{name: `execute off`, C: Cluster{windows: windows}, now: open, want: `route atl-atl may not change: execute is off`},
+		{name: `closed window`, C: Cluster{Execute: true, windows: windows}, now: closed, want: `route atl-atl may not change: outside maintenance windows, next window sat 09:00-10:00 opens at 2027-01-09T09:00:00Z`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if err := tt.C.checkExecute(`atl-atl`, tt.now); err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("checkExecute(%v) = %q; want %q", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWindowsErrors(t *testing.T) {
+	for _, raw := range []string{
+		`10:00`,
+		`mon-foo 10:00-11:00`,
+		`mon 10:00-11`,
+		`24:00-01:00`,
+		`10:60-11:00`,
+		`0 25 * * * 1h`,
+		`0 9 * * * 30s`,
+		`0 9 * * * soon`,
+		`0 9 5-1 * * 1h`,
+		`0 9 * * mon 1h extra`,
+		`*/0 * * * * 1h`,
+	} {
+		if _, err := parseWindows(time.UTC, raw); err == nil {
+			t.Errorf("parseWindows(%q) succeeded", raw)
+		}
+	}
+}
@@ -1,45 +1,43 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/jbvmio/zk"
+	gozk "github.com/samuel/go-zookeeper/zk"
 	"go.uber.org/zap"
 )
 
 const (
 	topicsPath    = `/CONFIGS/RESOURCE`
 	blacklistPath = `/BLACKLISTED_TOPICS`
+	idealPath     = `/IDEALSTATES`
+	externalPath  = `/EXTERNALVIEW`
 )
 
-var (
-	zkClient *zk.ZooKeeper
-)
-
-func launchZKClient(zkAddress ...string) error {
-	zkClient = zk.NewZooKeeper()
-	zkClient.EnableLogger(false)
-	zkClient.SetServers(zkAddress)
-	ok, err := zkClient.Exists("/")
+func (rc *routeClient) launchZKClient(zkAddress ...string) error {
+	rc.zk = zk.NewZooKeeper()
+	rc.zk.EnableLogger(false)
+	rc.zk.SetServers(zkAddress)
+	rc.zkServers = zkAddress
+	ok, err := rc.zk.Exists("/")
 	if !ok || err != nil {
 		return fmt.Errorf("Error Validating Zookeeper Configuration: %v", zkAddress)
 	}
 	return nil
 }
 
-func zkCheckExists(path string) (bool, error) {
-	return zkClient.Exists(path)
-}
-
-func zkLS(basePath string) []string {
-	sp, err := zkClient.Children(basePath)
+func (rc *routeClient) zkLS(basePath string) []string {
+	sp, err := rc.zk.Children(basePath)
 	for i := 0; i < 3; i++ {
 		if err == nil {
 			break
 		}
 		time.Sleep(time.Millisecond * 333)
-		sp, err = zkClient.Children(basePath)
+		sp, err = rc.zk.Children(basePath)
 	}
 	if err != nil {
 		logger.Error("Error retrieving path, retrying", zap.String("path", basePath))
@@ -47,15 +45,15 @@ func zkLS(basePath string) []string {
 	return sp
 }
 
-func zkListTopics(basePath string) []string {
+func (rc *routeClient) zkListTopics(basePath string) []string {
 	path := basePath + topicsPath
-	sp, err := zkClient.Children(path)
+	sp, err := rc.zk.Children(path)
 	for i := 0; i < 3; i++ {
 		if err == nil {
 			break
 		}
 		time.Sleep(time.Millisecond * 333)
-		sp, err = zkClient.Children(basePath)
+		sp, err = rc.zk.Children(basePath)
 	}
 	if err != nil {
 		logger.Error("Error retrieving path, retrying", zap.String("path", basePath))
@@ -63,18 +61,91 @@ func zkListTopics(basePath string) []string {
 	return sp
 }
 
-func zkListBlacklist(basePath string) []string {
+func (rc *routeClient) zkListBlacklist(basePath string) []string {
 	path := basePath + blacklistPath
-	sp, err := zkClient.Children(path)
+	sp, err := rc.zk.Children(path)
 	for i := 0; i < 3; i++ {
 		if err == nil {
 			break
 		}
 		time.Sleep(time.Millisecond * 333)
-		sp, err = zkClient.Children(path)
+		sp, err = rc.zk.Children(path)
 	}
 	if err != nil {
 		logger.Error("Error retrieving path, retrying", zap.String("path", path))
 	}
 	return sp
 }
+
+// zkIdealState is the part of a Helix IdealState record holding a topic's partitions.
+type zkIdealState struct {
+	SimpleFields map[string]string          `json:"simpleFields"`
+	MapFields    map[string]json.RawMessage `json:"mapFields"`
+}
+
+// zkListPartitions returns the partition count uReplicator has registered for each topic.
+// Topics without an IdealState are left out. A single session is used for every read,
+// since rc.zk opens a new connection per call.
+func (rc *routeClient) zkListPartitions(basePath string, topics ...string) (map[string]int, error) {
+	parts := make(map[string]int, len(topics))
+	if len(topics) < 1 {
+		return parts, nil
+	}
+	conn, _, err := gozk.Connect(rc.zkServers, time.Second*10, gozk.WithLogInfo(false))
+	if err != nil {
+		return parts, fmt.Errorf("unable to connect to zookeeper: %v", err)
+	}
+	defer conn.Close()
+	for _, topic := range topics {
+		path := basePath + idealPath + `/` + topic
+		data, _, err := conn.Get(path)
+		switch {
+		case err == gozk.ErrNoNode:
+			continue
+		case err != nil:
+			return parts, fmt.Errorf("unable to read %v: %v", path, err)
+		}
+		var state zkIdealState
+		if err := json.Unmarshal(data, &state); err != nil {
+			logger.Warn("Unable to parse IdealState", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		if n, err := strconv.Atoi(state.SimpleFields[`NUM_PARTITIONS`]); err == nil {
+			parts[topic] = n
+			continue
+		}
+		parts[topic] = len(state.MapFields)
+	}
+	return parts, nil
+}
+
+// zkOnlinePartitions returns how many partitions of a topic the uReplicator ExternalView shows
+// ONLINE on a worker.
+func (rc *routeClient) zkOnlinePartitions(basePath, topic string) (int, error) {
+	path := basePath + externalPath + `/` + topic
+	data, err := rc.zk.Get(path)
+	switch {
+	case err == gozk.ErrNoNode:
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("unable to read %v: %v", path, err)
+	}
+	var view zkIdealState
+	if err := json.Unmarshal(data, &view); err != nil {
+		return 0, fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+	var online int
+	for _, raw := range view.MapFields {
+		var instances map[string]string
+		if err := json.Unmarshal(raw, &instances); err != nil {
+			continue
+		}
+		for _, state := range instances {
+			if state == `ONLINE` {
+				online++
+				break
+			}
+		}
+	}
+	return online, nil
+}